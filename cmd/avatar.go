@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+func newAvatarCommand() *cobra.Command {
+	f := icon.AvatarFlags{
+		Size:      200,
+		TextColor: icon.AutoColor,
+		Shape:     icon.ShapeSquare,
+		OutputFlags: icon.OutputFlags{
+			Output:     ".",
+			Padding:    25,
+			OnExist:    icon.OnExistSkip,
+			Background: icon.AutoColor,
+		},
+	}
+
+	of := outputFlags{f: &f.OutputFlags}
+	pf := newPoolFlags()
+	var p *pool
+	command := cobra.Command{
+		Use:   "avatar [names...]",
+		Short: "Generate letter avatar from names",
+		Long: "Generate avatar with the initials of the names, for example \"Jane Doe\" gives \"JD\".\n" +
+			"The auto background color is chosen from a hash of the name, so the same name always has the same avatar.",
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(_ *cobra.Command, args []string) error {
+			if !slices.Contains(icon.Shapes, f.Shape) {
+				return fmt.Errorf("invalid --shape %q, must be one of %s", f.Shape, strings.Join(icon.Shapes, ", "))
+			}
+			if err := of.validate(); err != nil {
+				return err
+			}
+			if f.Output == icon.StdoutOutput {
+				if err := checkStdout(len(args)); err != nil {
+					return err
+				}
+			}
+			var err error
+			p, err = pf.validate()
+			return err
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			now := time.Now()
+			if !createOutputDir(f.Output) {
+				return
+			}
+			for _, name := range args {
+				err := p.Go(cmd.Context(), f.EstimateMemory(), func() {
+					f := f
+					f.Logger = jobLogger()
+					if out, err := icon.WriteAvatar(f, name); err != nil {
+						f.Logger.Error("Error writing image", slog.String("out", out.Path), slog.Any("err", err))
+					}
+				})
+				if err != nil {
+					break
+				}
+			}
+			p.Wait()
+			slog.Info("Processing completed", slog.Duration("took", time.Since(now)))
+		},
+	}
+
+	of.register(&command)
+	command.Flags().UintVarP(&f.Size, "size", "s", f.Size, "Size of the output image")
+	command.Flags().StringVarP(&f.Shape, "shape", "S", f.Shape, "Shape of the avatar [square, circle]")
+	command.Flags().StringVarP(&f.Background, "bg", "b", f.Background, "Background color ['auto' (hash of the name), 'transparent', hex, material, svg 1.1]")
+	command.Flags().StringVarP(&f.TextColor, "text-color", "t", f.TextColor, "Text color ['auto' (contrast of bg), hex, material, svg 1.1]")
+	command.Flags().UintVarP(&f.Padding, "padding", "p", f.Padding, "Padding of the text (by % of the size)")
+	command.Flags().UintVarP(&f.Round, "round", "r", f.Round, "Round the output image (by % of the size)")
+	command.Flags().IntVar(&f.PadX, "padx", f.PadX, "Additional padding to the x axis (by % of the size)")
+	command.Flags().IntVar(&f.PadY, "pady", f.PadY, "Additional padding to the y axis (by % of the size)")
+	pf.register(&command)
+	command.Flags().SortFlags = false
+	return &command
+}
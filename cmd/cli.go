@@ -1,153 +1,412 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/mawngo/piconic/internal/icon"
 	"github.com/mawngo/piconic/internal/scan"
-	"github.com/phsym/console-slog"
+	"github.com/mawngo/piconic/internal/utils"
+	"github.com/mawngo/piconic/piconic"
 	"github.com/spf13/cobra"
+	"io"
 	"log/slog"
 	"os"
-	"runtime"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 )
 
-func Init() *slog.LevelVar {
-	level := &slog.LevelVar{}
-	logger := slog.New(
-		console.NewHandler(os.Stderr, &console.HandlerOptions{
-			Level:      level,
-			TimeFormat: time.Kitchen,
-		}))
-	slog.SetDefault(logger)
-	cobra.EnableCommandSorting = false
-	return level
-}
-
 type CLI struct {
 	command *cobra.Command
 }
 
 // NewCLI create new CLI instance and setup application config.
 func NewCLI() *CLI {
-	level := Init()
-
-	f := icon.Flags{
-		Size: 200,
-		OutputFlags: icon.OutputFlags{
-			Output:     ".",
-			Padding:    10,
-			Round:      0,
-			Background: icon.AutoColor + "," + icon.BackgroundDefaultColor,
-			Trim:       icon.TransparentColor,
-		},
-	}
+	cobra.EnableCommandSorting = false
+	lf := logFlags{format: LogFormatConsole}
+	var logFile io.Closer
 
+	opts := piconic.DefaultIconOptions()
+	trim := strings.Join(opts.Trim, ",")
+	out := icon.OutputFlags{Output: ".", OnExist: icon.OnExistSkip}
+
+	// Placeholder only options, the padding, round and background are copied from opts.
+	placeholder := piconic.DefaultPlaceholderOptions(0, 0)
+	file := placeholderFile{Format: icon.FormatPNG, Quality: icon.DefaultJPEGQuality}
+	var shadow []int
+	fontFile := ""
+	fontWeight := icon.FontWeightSemiBold
+	var fallbackFonts []string
+	targetSize := "0"
+	from := ""
+	var fromJobs, argJobs []placeholderJob
+	of := outputFlags{f: &out}
+	watch := false
+	reportPath := ""
+	pf := newPoolFlags()
+	maxFileSize := "0"
+	var p *pool
+	limits := scan.Limits{}
 	command := cobra.Command{
 		Use:   "piconic [files...]",
 		Short: "Generate icon from images",
-		Args:  cobra.MinimumNArgs(1),
-		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
-			debug, err := cmd.PersistentFlags().GetBool("debug")
-			if err != nil {
-				return err
+		Long:  "Generate icon from images, directories of images, or the image read from stdin with '-'.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if from != "" {
+				return nil
 			}
-			if debug {
-				level.Set(slog.LevelDebug)
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			var err error
+			logFile, err = setupLog(lf)
+			return err
+		},
+		PersistentPostRun: func(_ *cobra.Command, _ []string) {
+			if logFile != nil {
+				_ = logFile.Close()
 			}
-			return nil
 		},
-		Run: func(_ *cobra.Command, args []string) {
-			now := time.Now()
-			if _, err := os.Stat(f.Output); err != nil {
-				err := os.Mkdir(f.Output, os.ModePerm)
-				if err != nil {
-					slog.Info("Error creating output directory", slog.Any("dir", f.Output))
-					return
+		PreRunE: func(_ *cobra.Command, args []string) error {
+			if watch {
+				if err := checkWatch(args, from, out.Output); err != nil {
+					return err
+				}
+			}
+			if err := of.validate(); err != nil {
+				return err
+			}
+			var err error
+			if p, err = pf.validate(); err != nil {
+				return err
+			}
+			if limits.MaxFileSize, err = utils.ParseByteSize(maxFileSize); err != nil {
+				return fmt.Errorf("invalid --max-file-size %q: %w", maxFileSize, err)
+			}
+			opts.Trim = strings.Split(trim, ",")
+			if err := opts.Validate(); err != nil {
+				return err
+			}
+			if err := checkPlaceholderFlags(&placeholder, &file, shadow, targetSize); err != nil {
+				return err
+			}
+			if !slices.Contains(icon.FontWeights, fontWeight) {
+				return fmt.Errorf("invalid --font-weight %q, must be one of %s", fontWeight, strings.Join(icon.FontWeights, ", "))
+			}
+			if fontFile != "" || fontWeight != icon.FontWeightSemiBold || len(fallbackFonts) > 0 {
+				if placeholder.Font, err = icon.LoadFont(fontFile, fontWeight, fallbackFonts); err != nil {
+					return fmt.Errorf("load font: %w", err)
+				}
+			}
+			placeholder.Padding, placeholder.Round, placeholder.Background = opts.Padding, opts.Round, opts.Background
+			base := placeholderJob{opts: placeholder, file: file}
+			if from != "" {
+				if fromJobs, err = readPlaceholderJobs(from, base); err != nil {
+					return err
 				}
 			}
-
-			concurrency := runtime.NumCPU()
-			con := make(chan struct{}, concurrency)
-
 			// If the first argument is a placeholder size, then switch to generating placeholder.
-			if _, _, ok := icon.ParsePlaceholderSize(args[0]); ok {
-				placeholders := make(map[string][]icon.PlaceholderFlags)
-				sizes := make([]icon.PlaceholderFlags, 0, len(args))
-				for _, arg := range args {
-					if w, h, ok := icon.ParsePlaceholderSize(arg); ok {
-						sizes = append(sizes, icon.PlaceholderFlags{
-							OutputFlags: f.OutputFlags,
-							W:           w,
-							H:           h,
-						})
-						continue
+			if len(args) > 0 && isPlaceholderSize(args[0]) {
+				argJobs = placeholderArgs(args, base)
+				for _, job := range argJobs {
+					if err := job.opts.Validate(); err != nil {
+						return fmt.Errorf("placeholder %dx%d: %w", job.opts.Width, job.opts.Height, err)
 					}
-					arg = strings.TrimSpace(arg)
-					placeholders[arg] = append(placeholders[arg], sizes...)
-					sizes = make([]icon.PlaceholderFlags, 0, len(args))
 				}
-				placeholders[""] = append(placeholders[""], sizes...)
-
-				for placeholder, sizes := range placeholders {
-					for _, size := range sizes {
-						processPlaceholder(size, placeholder, con)
-					}
+			}
+			if out.Output == icon.StdoutOutput {
+				outputs, err := countOutputs(args, fromJobs)
+				if err != nil {
+					return err
 				}
-			} else {
+				return checkStdout(outputs)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			now := time.Now()
+			if !createOutputDir(out.Output) {
+				return
+			}
+
+			ctx := cmd.Context()
+			rep := newReport(reportPath)
+			var w *watcher
+			for _, job := range slices.Concat(fromJobs, argJobs) {
+				processPlaceholder(ctx, out, job, p, rep)
+			}
+
+			if len(argJobs) == 0 {
 				// Generate icon mode.
+				if watch {
+					w = newWatcher(out, opts, limits, p, rep)
+				}
 				for _, arg := range args {
-					for img := range scan.Img(arg) {
-						processIcon(f, img, con)
+					for src := range scan.Img(arg, limits) {
+						if src.Err != nil {
+							reportScanError(src, rep)
+							continue
+						}
+						processIcon(ctx, out, opts, src, p, rep, w.record(src.Path))
 					}
 				}
 			}
 
-			for range concurrency {
-				con <- struct{}{}
-			}
+			p.Wait()
 			slog.Info("Processing completed", slog.Duration("took", time.Since(now)))
+			rep.flush()
+			if w != nil && ctx.Err() == nil {
+				w.watch(ctx, watchPaths(args))
+			}
 		},
 	}
 
-	command.Flags().StringVarP(&f.Output, "out", "o", f.Output, "Output directory name")
-	command.Flags().BoolVarP(&f.Overwrite, "overwrite", "w", f.Overwrite, "Overwrite output if exists")
-	command.Flags().UintVarP(&f.Size, "size", "s", f.Size, "Size of the output image")
-	command.Flags().StringVarP(&f.Background, "bg", "b", f.Background, "Background color ['transparent', 'auto', 'auto,fallback', hex, material, svg 1.1]")
-	command.Flags().StringVar(&f.Trim, "trim", f.Trim, "List of color to trim when process image")
-	command.Flags().UintVarP(&f.Padding, "padding", "p", f.Padding, "Padding of the icon image (by % of the size)")
-	command.Flags().UintVarP(&f.Round, "round", "r", f.Round, "Round the output image (by % of the size)")
-	command.Flags().UintVar(&f.SrcRound, "src-round", f.SrcRound, "Round the source image (by % of the size)")
-	command.Flags().IntVar(&f.PadX, "padx", f.PadX, "Additional padding to the x axis (by % of the size)")
-	command.Flags().IntVar(&f.PadY, "pady", f.PadY, "Additional padding to the y axis (by % of the size)")
-	command.PersistentFlags().Bool("debug", false, "Enable debug mode")
+	of.register(&command)
+	command.Flags().IntVarP(&opts.Size, "size", "s", opts.Size, "Size of the output image")
+	command.Flags().StringVarP(&opts.Background, "bg", "b", opts.Background, "Background color ['transparent', 'auto', 'auto,fallback', hex, material, svg 1.1]")
+	command.Flags().StringVar(&opts.Foreground, "fg", opts.Foreground, "Recolor the source image ['auto' (contrast of bg), hex, material, svg 1.1]")
+	command.Flags().BoolVar(&opts.Tint, "tint", opts.Tint, "Multiply the source colors with --fg instead of replacing them")
+	command.Flags().StringVar(&trim, "trim", trim, "List of color to trim when process image")
+	command.Flags().IntVarP(&opts.Padding, "padding", "p", opts.Padding, "Padding of the icon image (by % of the size)")
+	command.Flags().IntVarP(&opts.Round, "round", "r", opts.Round, "Round the output image (by % of the size)")
+	command.Flags().IntVar(&opts.SrcRound, "src-round", opts.SrcRound, "Round the source image (by % of the size)")
+	command.Flags().IntVar(&opts.PadX, "padx", opts.PadX, "Additional padding to the x axis (by % of the size)")
+	command.Flags().IntVar(&opts.PadY, "pady", opts.PadY, "Additional padding to the y axis (by % of the size)")
+	command.Flags().IntVar(&placeholder.MaxLines, "max-lines", placeholder.MaxLines, "Maximum number of lines to wrap the placeholder text into")
+	command.Flags().Float64Var(&placeholder.MinFontSize, "min-font-size", placeholder.MinFontSize, "Minimum placeholder font size, the text is truncated with an ellipsis if it does not fit (0 for no minimum)")
+	command.Flags().Float64Var(&placeholder.LineHeight, "line-height", placeholder.LineHeight, "Placeholder line height, relative to the font height")
+	command.Flags().StringVar(&placeholder.Style, "style", placeholder.Style, "Placeholder background style ["+strings.Join(icon.PlaceholderStyles, ", ")+"]")
+	command.Flags().IntVar(&placeholder.PatternSize, "pattern-size", placeholder.PatternSize, "Cell size of the placeholder checkerboard, stripes and grid in pixel (0 for default)")
+	command.Flags().IntVar(&placeholder.StrokeWidth, "stroke", placeholder.StrokeWidth, "Width of the placeholder text outline in pixel")
+	command.Flags().StringVar(&placeholder.StrokeColor, "stroke-color", placeholder.StrokeColor, "Color of the placeholder text outline ['auto' (contrast of text color), hex, material, svg 1.1]")
+	command.Flags().IntSliceVar(&shadow, "shadow", shadow, "Offset of the placeholder text shadow in pixel, for example 2,3")
+	command.Flags().StringVar(&placeholder.ShadowColor, "shadow-color", placeholder.ShadowColor, "Color of the placeholder text shadow [hex (#rrggbbaa for alpha), material, svg 1.1]")
+	command.Flags().Float64Var(&placeholder.LetterSpacing, "letter-spacing", placeholder.LetterSpacing, "Extra space between placeholder characters, relative to the font size, for example 0.1")
+	command.Flags().StringVar(&placeholder.AlignX, "align", placeholder.AlignX, "Horizontal alignment of the placeholder text ["+strings.Join(icon.Aligns, ", ")+"]")
+	command.Flags().StringVar(&placeholder.AlignY, "valign", placeholder.AlignY, "Vertical alignment of the placeholder text ["+strings.Join(icon.Aligns, ", ")+"]")
+	command.Flags().BoolVar(&placeholder.Uppercase, "uppercase", placeholder.Uppercase, "Transform the placeholder text to uppercase")
+	command.Flags().StringVar(&fontFile, "font", fontFile, "Placeholder font file (TTF/OTF), the embedded Roboto is used as fallback")
+	command.Flags().StringVar(&fontWeight, "font-weight", fontWeight, "Weight of the embedded Roboto placeholder font ["+strings.Join(icon.FontWeights, ", ")+"]")
+	command.Flags().StringSliceVar(&fallbackFonts, "fallback-font", fallbackFonts, "Font files (TTF/OTF) used for the placeholder characters missing from the font, required for CJK text")
+	command.Flags().StringVar(&file.Format, "format", file.Format, "Placeholder output format ["+strings.Join(icon.PlaceholderFormats, ", ")+"]")
+	command.Flags().IntVar(&file.Quality, "quality", file.Quality, "Quality of the jpeg placeholder (1-100)")
+	command.Flags().StringVar(&targetSize, "target-size", targetSize, "Pad the placeholder file to this size, for example 500KB, 2MB (0 to disable)")
+	command.Flags().StringVar(&from, "from", from, "Generate placeholders from the rows of the csv or json file, with size, text, color, bg and out columns")
+	command.Flags().StringVar(&placeholder.Seed, "seed", placeholder.Seed, "Seed of the placeholder 'auto' colors, same seed, text and size always generate the same colors")
+	command.Flags().Float64Var(&placeholder.MinContrast, "min-contrast", placeholder.MinContrast, "Only pick placeholder 'auto' colors having at least this contrast ratio against the text, for example 4.5 (0 to disable)")
+	command.Flags().BoolVar(&watch, "watch", watch, "Watch the input files and directories, regenerating the icons of changed sources and removing the icons of deleted sources")
+	command.Flags().StringVar(&reportPath, "report", reportPath, "Write the source, resolved colors, outputs, durations and errors of the processed inputs to the json file")
+	pf.register(&command)
+	command.Flags().Int64Var(&limits.MaxPixels, "max-pixels", limits.MaxPixels, "Reject source image having more pixels than this (0 for unlimited)")
+	command.Flags().IntVar(&limits.MaxWidth, "max-width", limits.MaxWidth, "Reject source image wider than this (0 for unlimited)")
+	command.Flags().IntVar(&limits.MaxHeight, "max-height", limits.MaxHeight, "Reject source image taller than this (0 for unlimited)")
+	command.Flags().StringVar(&maxFileSize, "max-file-size", maxFileSize, "Reject source file larger than this, for example 20MB (0 for unlimited)")
+	command.PersistentFlags().StringVar(&lf.format, "log-format", lf.format, "Format of the logs ["+strings.Join(LogFormats, ", ")+"]")
+	command.PersistentFlags().StringVar(&lf.file, "log-file", lf.file, "Append the logs to the file instead of stderr")
+	command.PersistentFlags().BoolVarP(&lf.quiet, "quiet", "q", lf.quiet, "Only log warnings and errors")
+	command.PersistentFlags().CountVarP(&lf.verbose, "verbose", "v", "Log debug messages, -vv also logs the source locations")
+	command.PersistentFlags().CountVar(&lf.verbose, "debug", "Enable debug mode")
+	_ = command.PersistentFlags().MarkDeprecated("debug", "use --verbose instead")
 	command.Flags().SortFlags = false
+	command.AddCommand(newAvatarCommand())
+	command.AddCommand(newSizesCommand())
+	command.AddCommand(newIdenticonCommand())
+	command.AddCommand(newServeCommand())
+	command.AddCommand(newWorkerCommand())
 	return &CLI{&command}
 }
 
+// Execute runs the command, the context of the command is canceled on interrupt.
 func (cli *CLI) Execute() {
-	if err := cli.command.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cli.command.ExecuteContext(ctx); err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err)
 	}
 }
 
-func processIcon(f icon.Flags, img scan.DecodedImage, con chan struct{}) {
-	con <- struct{}{}
-	go func() {
-		defer func() {
-			<-con
-		}()
-		icon.WriteIcon(f, img)
-	}()
+// resolveOnExist applies the --overwrite alias and validates the --on-exist policy.
+func resolveOnExist(f *icon.OutputFlags, overwrite bool) error {
+	if overwrite {
+		f.OnExist = icon.OnExistOverwrite
+	}
+	if !slices.Contains(icon.OnExistPolicies, f.OnExist) {
+		return fmt.Errorf("invalid --on-exist %q, must be one of %s", f.OnExist, strings.Join(icon.OnExistPolicies, ", "))
+	}
+	return nil
+}
+
+// checkPlaceholderFlags validates the placeholder file options and applies the --shadow and --target-size flags.
+// The rendering options are validated by piconic.
+func checkPlaceholderFlags(p *piconic.PlaceholderOptions, file *placeholderFile, shadow []int, targetSize string) error {
+	if file.Format == "jpg" {
+		file.Format = icon.FormatJPEG
+	}
+	if !slices.Contains(icon.PlaceholderFormats, file.Format) {
+		return fmt.Errorf("invalid --format %q, must be one of %s", file.Format, strings.Join(icon.PlaceholderFormats, ", "))
+	}
+	if file.Quality < 1 || file.Quality > 100 {
+		return fmt.Errorf("invalid --quality %d, must be between 1 and 100", file.Quality)
+	}
+	var err error
+	if file.TargetSize, err = utils.ParseByteSize(targetSize); err != nil {
+		return fmt.Errorf("invalid --target-size %q: %w", targetSize, err)
+	}
+	switch len(shadow) {
+	case 0:
+	case 1:
+		p.ShadowX, p.ShadowY = shadow[0], shadow[0]
+	case 2:
+		p.ShadowX, p.ShadowY = shadow[0], shadow[1]
+	default:
+		return fmt.Errorf("invalid --shadow %v, must be x,y offset", shadow)
+	}
+	return nil
+}
+
+// checkStdout validates that exactly one image is written when writing the images to stdout,
+// as the images written one after another cannot be told apart.
+func checkStdout(outputs int) error {
+	if outputs != 1 {
+		return fmt.Errorf("--out %s requires exactly one input producing one image, got %d images", icon.StdoutOutput, outputs)
+	}
+	return nil
+}
+
+// countOutputs returns the number of images generated from the inputs and the jobs of the --from file.
+// Directories are rejected, as their number of images is only known when scanned.
+func countOutputs(args []string, fromJobs []placeholderJob) (int, error) {
+	outputs := len(fromJobs)
+	if len(args) > 0 && isPlaceholderSize(args[0]) {
+		// Each size is generated once, for each of its densities.
+		for _, arg := range args {
+			if sizes, ok := icon.ParsePlaceholderSize(arg); ok {
+				outputs += len(sizes)
+			}
+		}
+		return outputs, nil
+	}
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			return 0, fmt.Errorf("--out %s cannot write the images of the directory %s", icon.StdoutOutput, arg)
+		}
+	}
+	return outputs + len(args), nil
+}
+
+// checkWatch validates that the inputs can be watched.
+func checkWatch(args []string, from string, out string) error {
+	if from != "" || (len(args) > 0 && isPlaceholderSize(args[0])) {
+		return errors.New("--watch requires image files or directories, not placeholders")
+	}
+	if slices.Contains(args, scan.Stdin) {
+		return errors.New("--watch cannot read the image from stdin")
+	}
+	if out == icon.StdoutOutput {
+		return errors.New("--watch cannot write the images to stdout")
+	}
+	return nil
+}
+
+// watchPaths returns the inputs that are files or directories.
+func watchPaths(args []string) []string {
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !scan.IsGlyph(arg) {
+			paths = append(paths, arg)
+		}
+	}
+	return paths
+}
+
+func createOutputDir(dir string) bool {
+	if dir == icon.StdoutOutput {
+		return true
+	}
+	if _, err := os.Stat(dir); err != nil {
+		err := os.Mkdir(dir, os.ModePerm)
+		if err != nil {
+			slog.Info("Error creating output directory", slog.Any("dir", dir))
+			return false
+		}
+	}
+	return true
+}
+
+// processIcon writes the icon of the source in the pool, records it to the report, then calls done if it is not nil.
+// The source is skipped if the context is done before it is admitted in the pool.
+func processIcon(ctx context.Context, out icon.OutputFlags, opts piconic.IconOptions, src scan.Source, p *pool, rep *report, done func(icon.Output, error)) {
+	_ = p.Go(ctx, iconMemory(opts, src), func() {
+		var o icon.Output
+		in, log := rep.add(&reportInput{Src: src.Path, Width: src.Width, Height: src.Height}, jobLogger())
+		out.Logger = log
+		img, err := src.Decode()
+		in.decoded()
+		if err != nil {
+			log.Error("Err decoding image", slog.String("path", src.Path), slog.Any("err", err))
+		} else if o, err = writeIcon(ctx, out, opts, img); err != nil {
+			log.Error("Error writing image", slog.String("out", o.Path), slog.Any("err", err))
+		}
+		in.done(o, err)
+		if done != nil {
+			done(o, err)
+		}
+	})
+}
+
+// reportScanError logs the source that cannot be read and records it to the report.
+func reportScanError(src scan.Source, rep *report) {
+	in, log := rep.add(&reportInput{Src: src.Path}, jobLogger())
+	log.Error("Err scanning image", slog.String("path", src.Path), slog.Any("err", src.Err))
+	in.done(icon.Output{}, src.Err)
+}
+
+// isPlaceholderSize reports whether the argument is a placeholder size.
+// An existing file or directory takes priority, as presets like hd or og are also common file names.
+func isPlaceholderSize(arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return false
+	}
+	_, ok := icon.ParsePlaceholderSize(arg)
+	return ok
+}
+
+// placeholderArgs returns the placeholder jobs of the arguments.
+// Each text is generated for the sizes before it, the sizes after the last text are generated with the default text.
+func placeholderArgs(args []string, base placeholderJob) []placeholderJob {
+	jobs := make([]placeholderJob, 0, len(args))
+	var sizes []icon.PlaceholderSize
+	add := func(text string) {
+		for _, size := range sizes {
+			job := base
+			job.opts.Width, job.opts.Height, job.opts.Density = size.W, size.H, size.Density
+			job.opts.Text = text
+			jobs = append(jobs, job)
+		}
+		sizes = nil
+	}
+	for _, arg := range args {
+		if parsed, ok := icon.ParsePlaceholderSize(arg); ok {
+			sizes = append(sizes, parsed...)
+			continue
+		}
+		add(strings.TrimSpace(arg))
+	}
+	add("")
+	return jobs
 }
 
-func processPlaceholder(f icon.PlaceholderFlags, text string, con chan struct{}) {
-	con <- struct{}{}
-	go func() {
-		defer func() {
-			<-con
-		}()
-		icon.WritePlaceholder(f, text)
-	}()
+func processPlaceholder(ctx context.Context, out icon.OutputFlags, job placeholderJob, p *pool, rep *report) {
+	_ = p.Go(ctx, placeholderMemory(job.opts), func() {
+		in, log := rep.add(&reportInput{Text: job.opts.Text}, jobLogger())
+		out.Logger = log
+		o, err := writePlaceholder(ctx, out, job.opts, job.file)
+		if err != nil {
+			log.Error("Error writing image", slog.String("out", o.Path), slog.Any("err", err))
+		}
+		in.done(o, err)
+	})
 }
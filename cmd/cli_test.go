@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mawngo/piconic/internal/icon"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCountOutputs(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		args     []string
+		fromJobs int
+		exp      int
+		err      string
+	}{
+		{args: []string{"-"}, exp: 1},
+		{args: []string{"logo.png"}, exp: 1},
+		{args: []string{"logo.png", "icon.svg"}, exp: 2},
+		{args: []string{dir}, err: "directory"},
+		{args: []string{"300x250", "Hello"}, exp: 1},
+		{args: []string{"300x250", "728x90", "Hello"}, exp: 2},
+		{args: []string{"300x250@2x"}, exp: 2},
+		{fromJobs: 1, exp: 1},
+		{args: []string{"300x250"}, fromJobs: 1, exp: 2},
+	}
+
+	for _, test := range tests {
+		outputs, err := countOutputs(test.args, make([]placeholderJob, test.fromJobs))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: expected error %q, got %v", test.args, test.err, err)
+			}
+			continue
+		}
+		if err != nil || outputs != test.exp {
+			t.Errorf("%v: expected %d outputs, got %d %v", test.args, test.exp, outputs, err)
+		}
+	}
+}
+
+func TestPlaceholderArgs(t *testing.T) {
+	type job struct {
+		w, h, density int
+		text          string
+	}
+	tests := []struct {
+		args []string
+		exp  []job
+	}{
+		{args: []string{"300x250"}, exp: []job{{w: 300, h: 250}}},
+		{args: []string{"300x250", "728x90", " Hello "}, exp: []job{{w: 300, h: 250, text: "Hello"}, {w: 728, h: 90, text: "Hello"}}},
+		{args: []string{"300x250", "Hello", "100x50@2x"}, exp: []job{{w: 300, h: 250, text: "Hello"}, {w: 100, h: 50, density: 1}, {w: 100, h: 50, density: 2}}},
+		{args: []string{"300x250", "Hello", "World"}, exp: []job{{w: 300, h: 250, text: "Hello"}}},
+	}
+
+	for _, test := range tests {
+		jobs := placeholderArgs(test.args, placeholderJob{})
+		got := make([]job, 0, len(jobs))
+		for _, j := range jobs {
+			got = append(got, job{w: j.opts.Width, h: j.opts.Height, density: j.opts.Density, text: j.opts.Text})
+		}
+		if !slices.Equal(got, test.exp) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.exp, got)
+		}
+	}
+}
+
+func TestPlaceholderSizeConflict(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.Mkdir("hd", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("300x250", []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		arg string
+		exp bool
+	}{
+		{arg: "og", exp: true},
+		{arg: "hd@2x", exp: true},
+		{arg: "728x90", exp: true},
+		{arg: "hd"},
+		{arg: "300x250"},
+		{arg: "logo.png"},
+	}
+
+	for _, test := range tests {
+		if got := isPlaceholderSize(test.arg); got != test.exp {
+			t.Errorf("%s: expected %v, got %v", test.arg, test.exp, got)
+		}
+	}
+	// The existing directory is read as icons, not generated as a placeholder.
+	if _, err := countOutputs([]string{"hd", "Hello"}, nil); err == nil || !strings.Contains(err.Error(), "directory") {
+		t.Errorf("expected the hd directory to be rejected, got %v", err)
+	}
+}
+
+func TestStdinToStdout(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	for y := 16; y < 48; y++ {
+		for x := 16; x < 48; x++ {
+			src.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	stdin, err := os.Create(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	if _, err := stdin.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stdin.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	origStdin, origStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() {
+		os.Stdin, os.Stdout = origStdin, origStdout
+	}()
+	cli := NewCLI()
+	cli.command.SetArgs([]string{"-", "--out", "-", "--size", "32", "--quiet"})
+	if err := cli.command.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin, os.Stdout = origStdin, origStdout
+
+	data, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode stdout: %v", err)
+	}
+	if out.Bounds().Dx() != 32 || out.Bounds().Dy() != 32 {
+		t.Errorf("expected 32x32 icon, got %v", out.Bounds())
+	}
+
+	cli = NewCLI()
+	cli.command.SetArgs([]string{"-", "-", "--out", "-", "--quiet"})
+	cli.command.SilenceUsage = true
+	cli.command.SilenceErrors = true
+	if err := cli.command.Execute(); err == nil || !strings.Contains(err.Error(), "exactly one input") {
+		t.Errorf("expected several inputs to be rejected, got %v", err)
+	}
+}
+
+func TestReportScanError(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.png")
+	if err := os.WriteFile(bad, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	large := filepath.Join(dir, "large.png")
+	if err := os.WriteFile(large, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.png")
+
+	out := filepath.Join(dir, "out")
+	reportPath := filepath.Join(dir, "report.json")
+	cli := NewCLI()
+	cli.command.SetArgs([]string{bad, large, missing, "--max-pixels", "10", "--out", out, "--report", reportPath, "--quiet"})
+	if err := cli.command.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file reportFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src string
+		err string
+	}{
+		{src: bad, err: "unknown format"},
+		{src: large, err: "max pixels"},
+		{src: missing, err: "missing.png"},
+	}
+	if len(file.Inputs) != len(tests) {
+		t.Fatalf("expected %d inputs, got %s", len(tests), data)
+	}
+	for i, test := range tests {
+		in := file.Inputs[i]
+		if in.Src != test.src || !strings.Contains(in.Error, test.err) {
+			t.Errorf("expected %s error %q, got %s %q", filepath.Base(test.src), test.err, in.Src, in.Error)
+		}
+	}
+}
+
+func TestReportWatchBatches(t *testing.T) {
+	type input struct {
+		src string
+		out string
+	}
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	rep := newReport(reportPath)
+	batches := []struct {
+		add     []input
+		removed []string
+		exp     []input
+	}{
+		{
+			add: []input{{src: "a.png", out: "a1"}, {src: "b.png", out: "b1"}, {src: "c.png", out: "c1"}},
+			exp: []input{{src: "a.png", out: "a1"}, {src: "b.png", out: "b1"}, {src: "c.png", out: "c1"}},
+		},
+		{
+			add:     []input{{src: "b.png", out: "b2"}, {src: "d.png", out: "d2"}},
+			removed: []string{"./c.png"},
+			exp:     []input{{src: "a.png", out: "a1"}, {src: "b.png", out: "b2"}, {src: "d.png", out: "d2"}},
+		},
+	}
+
+	for i, batch := range batches {
+		for _, in := range batch.add {
+			added, _ := rep.add(&reportInput{Src: in.src}, slog.Default())
+			added.done(icon.Output{Path: in.out}, nil)
+		}
+		for _, src := range batch.removed {
+			rep.remove(src)
+		}
+		rep.flush()
+
+		data, err := os.ReadFile(reportPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var file reportFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]input, 0, len(file.Inputs))
+		for _, in := range file.Inputs {
+			got = append(got, input{src: in.Src, out: in.Out})
+		}
+		if !slices.Equal(got, batch.exp) {
+			t.Errorf("batch %d: expected %v, got %v", i+1, batch.exp, got)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/utils"
+	"github.com/spf13/cobra"
+	"runtime"
+)
+
+// outputFlags are the --out, --on-exist and --overwrite flags, shared by the commands writing images.
+type outputFlags struct {
+	f         *icon.OutputFlags
+	overwrite bool
+}
+
+func (o *outputFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.f.Output, "out", "o", o.f.Output, "Output directory name ('-' to write the images to stdout)")
+	cmd.Flags().StringVar(&o.f.OnExist, "on-exist", o.f.OnExist, "Action when output exists [skip, overwrite, rename, newer]")
+	cmd.Flags().BoolVarP(&o.overwrite, "overwrite", "w", o.overwrite, "Overwrite output if exists, same as --on-exist=overwrite")
+}
+
+// validate applies the --overwrite alias and validates the --on-exist policy.
+func (o *outputFlags) validate() error {
+	return resolveOnExist(o.f, o.overwrite)
+}
+
+// poolFlags are the --jobs and --max-memory flags, shared by the commands processing images in a pool.
+type poolFlags struct {
+	jobs      int
+	maxMemory string
+}
+
+func newPoolFlags() poolFlags {
+	return poolFlags{maxMemory: "0"}
+}
+
+func (p *poolFlags) register(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&p.jobs, "jobs", "j", p.jobs, "Number of images to process concurrently (0 for number of CPUs)")
+	cmd.Flags().StringVar(&p.maxMemory, "max-memory", p.maxMemory, "Maximum estimated memory used by concurrent jobs, for example 512MB, 2GiB (0 for unlimited)")
+}
+
+// validate creates the pool from the flags.
+func (p *poolFlags) validate() (*pool, error) {
+	jobs := p.jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	budget, err := utils.ParseByteSize(p.maxMemory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --max-memory %q: %w", p.maxMemory, err)
+	}
+	return newPool(jobs, budget), nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/spf13/cobra"
+	"strings"
+	"testing"
+)
+
+func TestSharedFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		onExist string
+		jobs    int
+		budget  int64
+		err     string
+	}{
+		{name: "defaults", onExist: icon.OnExistSkip, jobs: 1},
+		{name: "overwrite alias", args: []string{"-w", "--on-exist", "rename"}, onExist: icon.OnExistOverwrite, jobs: 1},
+		{name: "on exist", args: []string{"--on-exist", "newer", "-j", "3", "--max-memory", "1KB"}, onExist: icon.OnExistNewer, jobs: 3, budget: 1000},
+		{name: "bad on exist", args: []string{"--on-exist", "keep"}, err: `invalid --on-exist "keep"`},
+		{name: "bad max memory", args: []string{"--max-memory", "lots"}, err: `invalid --max-memory "lots"`},
+	}
+
+	for _, test := range tests {
+		f := icon.OutputFlags{OnExist: icon.OnExistSkip}
+		of := outputFlags{f: &f}
+		pf := newPoolFlags()
+		pf.jobs = 1
+		var p *pool
+		command := cobra.Command{
+			RunE: func(_ *cobra.Command, _ []string) error {
+				if err := of.validate(); err != nil {
+					return err
+				}
+				var err error
+				p, err = pf.validate()
+				return err
+			},
+		}
+		of.register(&command)
+		pf.register(&command)
+		command.SetArgs(test.args)
+		command.SilenceUsage, command.SilenceErrors = true, true
+		err := command.Execute()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if f.OnExist != test.onExist || cap(p.jobs) != test.jobs || p.budget != test.budget {
+			t.Errorf("%s: expected %s %d %d, got %s %d %d", test.name, test.onExist, test.jobs, test.budget, f.OnExist, cap(p.jobs), p.budget)
+		}
+	}
+}
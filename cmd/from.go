@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnsupportedJobFile = errors.New("unsupported job file, must be .csv or .json")
+
+// placeholderRow is a row of the job file.
+type placeholderRow struct {
+	Size  string `json:"size"`
+	Text  string `json:"text"`
+	Color string `json:"color"`
+	Bg    string `json:"bg"`
+	Out   string `json:"out"`
+}
+
+// placeholderColumnAliases maps the other accepted csv header names to the columns.
+var placeholderColumnAliases = map[string]string{
+	"text-color": "color",
+	"background": "bg",
+	"output":     "out",
+	"name":       "out",
+}
+
+// readPlaceholderJobs reads the placeholder jobs from the csv or json file.
+// The columns of the row override the base job, a size with density generates a job for each density.
+func readPlaceholderJobs(path string, base placeholderJob) ([]placeholderJob, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows []placeholderRow
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = readPlaceholderCSV(file)
+	case ".json":
+		err = json.NewDecoder(file).Decode(&rows)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedJobFile, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	jobs := make([]placeholderJob, 0, len(rows))
+	for i, row := range rows {
+		sizes, ok := icon.ParsePlaceholderSize(strings.TrimSpace(row.Size))
+		if !ok {
+			return nil, fmt.Errorf("%s: row %d: invalid size %q", path, i+1, row.Size)
+		}
+		job := base
+		job.opts.Text = strings.TrimSpace(row.Text)
+		job.opts.TextColor = strings.TrimSpace(row.Color)
+		job.file.Name = strings.TrimSpace(row.Out)
+		if bg := strings.TrimSpace(row.Bg); bg != "" {
+			job.opts.Background = bg
+		}
+		for _, size := range sizes {
+			job.opts.Width, job.opts.Height, job.opts.Density = size.W, size.H, size.Density
+			if err := job.opts.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: row %d: %w", path, i+1, err)
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// readPlaceholderCSV reads the rows of the csv, the first line is the header naming the columns.
+func readPlaceholderCSV(r io.Reader) ([]placeholderRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[placeholderColumn(name)] = i
+	}
+	if _, ok := columns["size"]; !ok {
+		return nil, errors.New("missing size column")
+	}
+
+	var rows []placeholderRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		rows = append(rows, placeholderRow{
+			Size:  field("size"),
+			Text:  field("text"),
+			Color: field("color"),
+			Bg:    field("bg"),
+			Out:   field("out"),
+		})
+	}
+}
+
+// placeholderColumn returns the column named by the csv header, ignoring case, separators and aliases.
+func placeholderColumn(name string) string {
+	// Spreadsheets may start the file with a byte order mark.
+	name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	name = strings.NewReplacer("_", "-", " ", "-").Replace(name)
+	if column, ok := placeholderColumnAliases[name]; ok {
+		return column
+	}
+	return name
+}
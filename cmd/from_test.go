@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/piconic"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPlaceholderJobs(t *testing.T) {
+	type job struct {
+		w, h                 int
+		text, color, bg, out string
+	}
+	tests := []struct {
+		name string
+		file string
+		data string
+		exp  []job
+		err  string
+	}{
+		{
+			name: "columns",
+			file: "jobs.csv",
+			data: "size,text,color,bg,out\n300x250,Slot A,white,Blue700,slot-a\n",
+			exp:  []job{{w: 300, h: 250, text: "Slot A", color: "white", bg: "Blue700", out: "slot-a"}},
+		},
+		{
+			name: "header aliases",
+			file: "jobs.csv",
+			data: "\ufeffSize, Text ,Text Color,Background,Output\n300x250,Slot A,white,Blue700,slot-a\n",
+			exp:  []job{{w: 300, h: 250, text: "Slot A", color: "white", bg: "Blue700", out: "slot-a"}},
+		},
+		{
+			name: "reordered and missing columns",
+			file: "jobs.csv",
+			data: "name,size\nbanner,728x90\n",
+			exp:  []job{{w: 728, h: 90, bg: icon.AutoColor, out: "banner"}},
+		},
+		{
+			name: "per row out",
+			file: "jobs.csv",
+			data: "size,out\n300x250,a.png\n300x250\n100x50@2x,b\n",
+			exp: []job{
+				{w: 300, h: 250, bg: icon.AutoColor, out: "a.png"},
+				{w: 300, h: 250, bg: icon.AutoColor},
+				{w: 100, h: 50, bg: icon.AutoColor, out: "b"},
+				{w: 200, h: 100, bg: icon.AutoColor, out: "b"},
+			},
+		},
+		{
+			name: "json",
+			file: "jobs.json",
+			data: `[{"size": "og", "text": "Post", "out": "post"}]`,
+			exp:  []job{{w: 1200, h: 630, text: "Post", bg: icon.AutoColor, out: "post"}},
+		},
+		{name: "missing size column", file: "jobs.csv", data: "text,out\nSlot A,a\n", err: "missing size column"},
+		{name: "bad size", file: "jobs.csv", data: "size\n300x250\n300y250\n", err: `row 2: invalid size "300y250"`},
+		{name: "empty size", file: "jobs.json", data: `[{"text": "Slot A"}]`, err: `row 1: invalid size ""`},
+		{name: "invalid color", file: "jobs.csv", data: "size,color\n300x250,white\n300x250,whiter\n", err: "row 2: invalid color"},
+		{name: "unsupported file", file: "jobs.txt", data: "size\n300x250\n", err: ErrUnsupportedJobFile.Error()},
+	}
+
+	base := placeholderJob{opts: piconic.PlaceholderOptions{Background: icon.AutoColor}}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.file)
+		if err := os.WriteFile(path, []byte(test.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := readPlaceholderJobs(path, base)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		got := make([]job, 0, len(jobs))
+		for _, j := range jobs {
+			density := max(j.opts.Density, 1)
+			got = append(got, job{w: j.opts.Width * density, h: j.opts.Height * density, text: j.opts.Text, color: j.opts.TextColor, bg: j.opts.Background, out: j.file.Name})
+		}
+		if len(got) != len(test.exp) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.exp, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.exp[i] {
+				t.Errorf("%s: job %d: expected %v, got %v", test.name, i, test.exp[i], got[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+func newIdenticonCommand() *cobra.Command {
+	f := icon.IdenticonFlags{
+		Size:  200,
+		Style: icon.IdenticonStyleGrid,
+		OutputFlags: icon.OutputFlags{
+			Output:     ".",
+			Padding:    10,
+			OnExist:    icon.OnExistSkip,
+			Background: icon.AutoColor,
+		},
+		Foreground: icon.AutoColor,
+	}
+
+	of := outputFlags{f: &f.OutputFlags}
+	pf := newPoolFlags()
+	var p *pool
+	command := cobra.Command{
+		Use:   "identicon [inputs...]",
+		Short: "Generate identicon from strings",
+		Long: "Generate identicon from the hash of the input strings, for example repository names.\n" +
+			"The same input always generates the same identicon.",
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(_ *cobra.Command, args []string) error {
+			if !slices.Contains(icon.IdenticonStyles, f.Style) {
+				return fmt.Errorf("invalid --style %q, must be one of %s", f.Style, strings.Join(icon.IdenticonStyles, ", "))
+			}
+			if err := of.validate(); err != nil {
+				return err
+			}
+			if f.Output == icon.StdoutOutput {
+				if err := checkStdout(len(args)); err != nil {
+					return err
+				}
+			}
+			var err error
+			p, err = pf.validate()
+			return err
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			now := time.Now()
+			if !createOutputDir(f.Output) {
+				return
+			}
+			for _, input := range args {
+				err := p.Go(cmd.Context(), f.EstimateMemory(), func() {
+					f := f
+					f.Logger = jobLogger()
+					if out, err := icon.WriteIdenticon(f, input); err != nil {
+						f.Logger.Error("Error writing image", slog.String("out", out.Path), slog.Any("err", err))
+					}
+				})
+				if err != nil {
+					break
+				}
+			}
+			p.Wait()
+			slog.Info("Processing completed", slog.Duration("took", time.Since(now)))
+		},
+	}
+
+	of.register(&command)
+	command.Flags().UintVarP(&f.Size, "size", "s", f.Size, "Size of the output image")
+	command.Flags().StringVar(&f.Style, "style", f.Style, "Style of the identicon [grid, ring, bauhaus]")
+	command.Flags().StringVarP(&f.Background, "bg", "b", f.Background, "Background color ['auto' (hash of the input), 'transparent', hex, material, svg 1.1]")
+	command.Flags().StringVar(&f.Foreground, "fg", f.Foreground, "Main pattern color ['auto' (hash of the input), hex, material, svg 1.1]")
+	command.Flags().UintVarP(&f.Padding, "padding", "p", f.Padding, "Padding of the pattern (by % of the size)")
+	command.Flags().UintVarP(&f.Round, "round", "r", f.Round, "Round the output image (by % of the size)")
+	command.Flags().IntVar(&f.PadX, "padx", f.PadX, "Additional padding to the x axis (by % of the size)")
+	command.Flags().IntVar(&f.PadY, "pady", f.PadY, "Additional padding to the y axis (by % of the size)")
+	pf.register(&command)
+	command.Flags().SortFlags = false
+	return &command
+}
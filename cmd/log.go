@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/phsym/console-slog"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Formats of the logs.
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+	LogFormatLogfmt  = "logfmt"
+)
+
+var LogFormats = []string{LogFormatConsole, LogFormatJSON, LogFormatLogfmt}
+
+// logFlags are the flags of the logs, shared by all commands.
+type logFlags struct {
+	format string
+	file   string
+	quiet  bool
+	// verbose is the number of -v, 1 logs the debug messages and 2 also logs their source locations.
+	verbose int
+}
+
+// jobIDs numbers the jobs run in the pool, so their interleaved logs can be correlated.
+var jobIDs atomic.Int64
+
+// jobLogger returns the default logger with the id of a new job.
+func jobLogger() *slog.Logger {
+	return slog.With(slog.Int64("job", jobIDs.Add(1)))
+}
+
+// setupLog replaces the default logger with the one configured by the flags.
+// The returned closer closes the log file, nil if the logs are written to stderr.
+func setupLog(f logFlags) (io.Closer, error) {
+	if !slices.Contains(LogFormats, f.format) {
+		return nil, fmt.Errorf("invalid --log-format %q, must be one of %s", f.format, strings.Join(LogFormats, ", "))
+	}
+	if f.quiet && f.verbose > 0 {
+		return nil, fmt.Errorf("--quiet and --verbose cannot be used together")
+	}
+	level := slog.LevelInfo
+	switch {
+	case f.verbose > 0:
+		level = slog.LevelDebug
+	case f.quiet:
+		level = slog.LevelWarn
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if f.file != "" {
+		file, err := os.OpenFile(f.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open --log-file: %w", err)
+		}
+		w, closer = file, file
+	}
+
+	addSource := f.verbose > 1
+	var handler slog.Handler
+	switch f.format {
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, AddSource: addSource})
+	case LogFormatLogfmt:
+		handler = slog.NewTextHandler(w, &slog.HandlerOptions{Level: level, AddSource: addSource})
+	default:
+		handler = console.NewHandler(w, &console.HandlerOptions{
+			Level:      level,
+			AddSource:  addSource,
+			TimeFormat: time.Kitchen,
+			// No escape codes in the log file.
+			NoColor: f.file != "",
+		})
+	}
+	slog.SetDefault(slog.New(handler))
+	return closer, nil
+}
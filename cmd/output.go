@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"github.com/mawngo/piconic/piconic"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// placeholderFile are the options of the placeholder file, the rendering options are piconic.PlaceholderOptions.
+type placeholderFile struct {
+	// Name of the file, empty to name it from the text and the size.
+	Name       string
+	Format     string
+	Quality    int
+	TargetSize int64
+}
+
+// placeholderJob is a placeholder to generate.
+type placeholderJob struct {
+	opts piconic.PlaceholderOptions
+	file placeholderFile
+}
+
+// iconMemory returns the approximate bytes needed to generate the icon of the source.
+func iconMemory(opts piconic.IconOptions, src scan.Source) int64 {
+	return icon.Flags{Size: uint(max(opts.Size, 0))}.EstimateMemory(src)
+}
+
+// placeholderMemory returns the approximate bytes needed to generate the placeholder.
+func placeholderMemory(opts piconic.PlaceholderOptions) int64 {
+	density := max(opts.Density, 1)
+	return icon.PlaceholderFlags{W: opts.Width * density, H: opts.Height * density}.EstimateMemory()
+}
+
+// writeIcon renders the icon of the image and writes it to the output directory.
+// Only the Output, the OnExist and the Logger of the output flags are used.
+func writeIcon(ctx context.Context, out icon.OutputFlags, opts piconic.IconOptions, img scan.DecodedImage) (o icon.Output, err error) {
+	name, label := img.Name, img.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(img.Path), filepath.Ext(img.Path))
+		label = filepath.Base(img.Path)
+	}
+	log := outputLogger(out)
+	log.Info("Processing",
+		slog.String("img", label),
+		slog.String("dimension", fmt.Sprintf("%dx%d", img.Width, img.Height)),
+		slog.String("bg", opts.Background),
+		slog.Int("size", opts.Size),
+	)
+
+	outName := fmt.Sprintf("%s.%dpc%d.png", icon.NormalizeFileName(name), opts.Size, opts.Padding)
+	outfile, release, ok := icon.ReserveOutFile(out, outName, img.Path)
+	if !ok {
+		return icon.Output{Path: outfile, Skipped: true}, nil
+	}
+	defer func() { release(err) }()
+
+	m, err := piconic.RenderIcon(piconic.WithLogger(ctx, log), img, opts)
+	if err != nil {
+		return icon.Output{Path: outfile}, err
+	}
+	b := m.Bounds()
+	o = icon.Output{Path: outfile, Width: b.Dx(), Height: b.Dy(), Background: icon.FormatOutputColor(m.Background), Trim: m.Trim}
+	o.Size, err = icon.WriteOutFile(log, outfile, icon.FormatPNG, 0, func(w io.Writer) error {
+		return piconic.Encode(w, m.Image, icon.FormatPNG, 0)
+	})
+	return o, err
+}
+
+// writePlaceholder renders the placeholder and writes it to the output directory.
+// Only the Output, the OnExist and the Logger of the output flags are used.
+func writePlaceholder(ctx context.Context, out icon.OutputFlags, opts piconic.PlaceholderOptions, file placeholderFile) (o icon.Output, err error) {
+	density := max(opts.Density, 1)
+	dimStr := fmt.Sprintf("%dx%d", opts.Width, opts.Height)
+	text := opts.Text
+	if text == "" {
+		text = dimStr
+	}
+	if text == piconic.NoText {
+		text = ""
+	}
+	log := outputLogger(out)
+	log.Info("Processing",
+		slog.String("text", text),
+		slog.String("dimension", dimStr),
+		slog.String("bg", opts.Background),
+	)
+
+	// Validate before reserving the file, so the invalid options are not reported as encoding errors.
+	bg, _, err := piconic.PlaceholderColors(opts)
+	if err != nil {
+		return icon.Output{}, err
+	}
+	outName := fmt.Sprintf("%spc%d%s", dimStr, opts.Padding, icon.FormatExt(file.Format))
+	if density > 1 {
+		outName = fmt.Sprintf("%spc%d@%dx%s", dimStr, opts.Padding, density, icon.FormatExt(file.Format))
+	}
+	if opts.Style != "" && opts.Style != piconic.StyleFlat {
+		outName = opts.Style + outName
+	}
+	if text != "" && text != dimStr {
+		outName = icon.NormalizeFileName(text) + "." + outName
+	}
+	if file.Name != "" {
+		outName = icon.PlaceholderFileName(file.Name, density, file.Format)
+	}
+	outfile, release, ok := icon.ReserveOutFile(out, outName, "")
+	if !ok {
+		return icon.Output{Path: outfile, Skipped: true}, nil
+	}
+	defer func() { release(err) }()
+
+	ctx = piconic.WithLogger(ctx, log)
+	o = icon.Output{Path: outfile, Width: opts.Width * density, Height: opts.Height * density, Background: icon.FormatOutputColor(bg)}
+	o.Size, err = icon.WriteOutFile(log, outfile, file.Format, file.TargetSize, func(w io.Writer) error {
+		if file.Format == icon.FormatSVG {
+			return piconic.EncodePlaceholderSVG(ctx, w, opts)
+		}
+		img, err := piconic.RenderPlaceholder(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return piconic.Encode(w, img, file.Format, file.Quality)
+	})
+	return o, err
+}
+
+// outputLogger returns the logger of the output flags, or the default logger.
+func outputLogger(out icon.OutputFlags) *slog.Logger {
+	if out.Logger == nil {
+		return slog.Default()
+	}
+	return out.Logger
+}
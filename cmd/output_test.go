@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"github.com/mawngo/piconic/piconic"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWritePlaceholder(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(job *placeholderJob)
+		exp    string
+		w, h   int
+	}{
+		{name: "size", exp: "300x250pc10.png", w: 300, h: 250},
+		{name: "text", modify: func(job *placeholderJob) { job.opts.Text = "Slot A" }, exp: "Slot-A.300x250pc10.png", w: 300, h: 250},
+		{name: "no text", modify: func(job *placeholderJob) { job.opts.Text = piconic.NoText }, exp: "300x250pc10.png", w: 300, h: 250},
+		{name: "density", modify: func(job *placeholderJob) { job.opts.Density = 2 }, exp: "300x250pc10@2x.png", w: 600, h: 500},
+		{name: "style", modify: func(job *placeholderJob) { job.opts.Style = piconic.StyleGrid }, exp: "grid300x250pc10.png", w: 300, h: 250},
+		{name: "svg", modify: func(job *placeholderJob) { job.file.Format = icon.FormatSVG }, exp: "300x250pc10.svg", w: 300, h: 250},
+		{
+			name: "file name",
+			modify: func(job *placeholderJob) {
+				job.opts.Density = 2
+				job.file.Name = "../slot"
+			},
+			exp: "slot@2x.png", w: 600, h: 500,
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		job := placeholderJob{
+			opts: piconic.DefaultPlaceholderOptions(300, 250),
+			file: placeholderFile{Format: icon.FormatPNG, Quality: icon.DefaultJPEGQuality},
+		}
+		if test.modify != nil {
+			test.modify(&job)
+		}
+		out := icon.OutputFlags{Output: dir, OnExist: icon.OnExistSkip}
+		o, err := writePlaceholder(context.Background(), out, job.opts, job.file)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if o.Path != filepath.Join(dir, test.exp) || o.Width != test.w || o.Height != test.h {
+			t.Errorf("%s: expected %s %dx%d, got %s %dx%d", test.name, test.exp, test.w, test.h, o.Path, o.Width, o.Height)
+		}
+		if info, err := os.Stat(o.Path); err != nil || info.Size() != o.Size {
+			t.Errorf("%s: expected the written file of %d bytes, got %v", test.name, o.Size, err)
+		}
+	}
+}
+
+func TestWritePlaceholderInvalid(t *testing.T) {
+	dir := t.TempDir()
+	opts := piconic.DefaultPlaceholderOptions(300, 250)
+	opts.Text = "Slot A <nope>"
+	out := icon.OutputFlags{Output: dir, OnExist: icon.OnExistSkip}
+	if _, err := writePlaceholder(context.Background(), out, opts, placeholderFile{Format: icon.FormatPNG}); err == nil {
+		t.Errorf("expected the invalid text color to be rejected")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no file to be written, got %d", len(entries))
+	}
+}
+
+func TestWriteIconVector(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logo.svg")
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24"><rect x="4" y="4" width="16" height="16" fill="red"/></svg>`
+	if err := os.WriteFile(path, []byte(svg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := piconic.DefaultIconOptions()
+	opts.Size = 64
+	out := icon.OutputFlags{Output: dir, OnExist: icon.OnExistSkip}
+	for src := range scan.Img(path, scan.Limits{}) {
+		img, err := src.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := writeIcon(context.Background(), out, opts, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.Path != filepath.Join(dir, "logo.64pc10.png") || o.Width != 64 || o.Height != 64 || o.Background == "" {
+			t.Errorf("unexpected output %+v", o)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+)
+
+// pool runs jobs in goroutines, limited by the number of concurrent jobs and a memory budget.
+type pool struct {
+	jobs chan struct{}
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	budget int64
+	used   int64
+}
+
+// newPool creates a pool running at most jobs concurrently.
+// The budget is the maximum estimated memory in bytes of running jobs, 0 means unlimited.
+func newPool(jobs int, budget int64) *pool {
+	p := &pool{
+		jobs:   make(chan struct{}, jobs),
+		budget: budget,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Go blocks until the job can be admitted, then runs it in a new goroutine.
+// Job that costs more than the whole budget is run alone.
+// If the context is done before the job is admitted, the job is not run and the error of the context is returned.
+func (p *pool) Go(ctx context.Context, cost int64, fn func()) error {
+	select {
+	case p.jobs <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	cost, err := p.acquire(ctx, cost)
+	if err != nil {
+		<-p.jobs
+		return err
+	}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			p.release(cost)
+			<-p.jobs
+			p.wg.Done()
+		}()
+		fn()
+	}()
+	return nil
+}
+
+// Wait waits for all admitted jobs to complete.
+func (p *pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *pool) acquire(ctx context.Context, cost int64) (int64, error) {
+	if p.budget <= 0 {
+		return 0, nil
+	}
+	cost = min(cost, p.budget)
+	// Wake up the waiters when the context is done, as the cond cannot wait for it.
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.cond.Broadcast()
+	})
+	defer stop()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.used+cost > p.budget {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		p.cond.Wait()
+	}
+	p.used += cost
+	return cost, nil
+}
+
+func (p *pool) release(cost int64) {
+	if cost == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.used -= cost
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
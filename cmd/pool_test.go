@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		jobs   int
+		budget int64
+		costs  []int64
+		max    int64
+	}{
+		{name: "unlimited budget", jobs: 3, costs: []int64{10, 10, 10, 10, 10, 10}, max: 3},
+		{name: "limited by budget", jobs: 8, budget: 25, costs: []int64{10, 10, 10, 10, 10, 10}, max: 2},
+		{name: "limited by jobs", jobs: 2, budget: 100, costs: []int64{10, 10, 10, 10, 10, 10}, max: 2},
+		{name: "larger than budget", jobs: 4, budget: 25, costs: []int64{100, 10, 100, 10}, max: 1},
+		{name: "only larger than budget", jobs: 4, budget: 25, costs: []int64{100}, max: 1},
+	}
+
+	for _, test := range tests {
+		p := newPool(test.jobs, test.budget)
+		var running, peak atomic.Int64
+		var overBudget atomic.Bool
+		for _, cost := range test.costs {
+			err := p.Go(context.Background(), cost, func() {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					old := peak.Load()
+					if n <= old || peak.CompareAndSwap(old, n) {
+						break
+					}
+				}
+				p.mu.Lock()
+				if test.budget > 0 && p.used > test.budget {
+					overBudget.Store(true)
+				}
+				p.mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+			})
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+		}
+
+		done := make(chan struct{})
+		go func() {
+			p.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: jobs did not complete", test.name)
+		}
+		if got := peak.Load(); got > test.max {
+			t.Errorf("%s: expected at most %d concurrent jobs, got %d", test.name, test.max, got)
+		}
+		if overBudget.Load() {
+			t.Errorf("%s: used memory exceeded the budget", test.name)
+		}
+	}
+}
+
+func TestPoolCanceled(t *testing.T) {
+	tests := []struct {
+		name   string
+		jobs   int
+		budget int64
+	}{
+		{name: "waiting for jobs", jobs: 1, budget: 0},
+		{name: "waiting for budget", jobs: 2, budget: 10},
+	}
+
+	for _, test := range tests {
+		p := newPool(test.jobs, test.budget)
+		unblock := make(chan struct{})
+		if err := p.Go(context.Background(), 10, func() { <-unblock }); err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+		ran := false
+		go func() {
+			errs <- p.Go(ctx, 10, func() { ran = true })
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: expected canceled error, got %v", test.name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: waiting job was not canceled", test.name)
+		}
+		close(unblock)
+		p.Wait()
+		if ran {
+			t.Errorf("%s: canceled job was run", test.name)
+		}
+		// The canceled job must not leak its slot or budget.
+		if err := p.Go(context.Background(), 10, func() {}); err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		p.Wait()
+		if p.used != 0 || len(p.jobs) != 0 {
+			t.Errorf("%s: expected the pool to be released, got used %d and %d jobs", test.name, p.used, len(p.jobs))
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/utils"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// report records the processed inputs and writes them as json.
+// The source images are recorded by path, so in watch mode the report keeps the inputs of all the batches,
+// the reprocessed source replacing its previous input.
+// A nil report records nothing.
+type report struct {
+	path string
+
+	mu      sync.Mutex
+	started time.Time
+	// inputs are the inputs without source image, and sources are the source image inputs by path.
+	inputs  []*reportInput
+	sources map[string]*reportInput
+}
+
+// reportFile is the json of the report.
+type reportFile struct {
+	Started    time.Time      `json:"started"`
+	DurationMS float64        `json:"duration_ms"`
+	Inputs     []*reportInput `json:"inputs"`
+}
+
+// reportInput is a processed source image or placeholder.
+type reportInput struct {
+	// Src is the source image path, empty for placeholders.
+	Src string `json:"src,omitempty"`
+	// Text of the placeholder.
+	Text string `json:"text,omitempty"`
+	// Width and Height of the source image.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Out is the output path, and OutWidth, OutHeight and Size are the output image and file sizes.
+	Out       string `json:"out,omitempty"`
+	OutWidth  int    `json:"out_width,omitempty"`
+	OutHeight int    `json:"out_height,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	// Background is the resolved background color.
+	Background string `json:"bg,omitempty"`
+	// Trim is the area of the source image kept after trimming, as [x0, y0, x1, y1].
+	Trim       []int    `json:"trim,omitempty"`
+	Skipped    bool     `json:"skipped,omitempty"`
+	DecodeMS   float64  `json:"decode_ms,omitempty"`
+	DurationMS float64  `json:"duration_ms"`
+	Warnings   []string `json:"warnings,omitempty"`
+	Error      string   `json:"error,omitempty"`
+
+	start time.Time
+	mu    sync.Mutex
+}
+
+// newReport creates the report written to the path, or returns nil if the path is empty.
+func newReport(path string) *report {
+	if path == "" {
+		return nil
+	}
+	return &report{path: path, started: time.Now(), sources: make(map[string]*reportInput)}
+}
+
+// add starts recording the input, and returns it with the logger also collecting its warnings.
+// It returns nil and the logger if the report is nil.
+func (r *report) add(in *reportInput, log *slog.Logger) (*reportInput, *slog.Logger) {
+	if r == nil {
+		return nil, log
+	}
+	in.start = time.Now()
+	r.mu.Lock()
+	if in.Src != "" {
+		r.sources[filepath.Clean(in.Src)] = in
+	} else {
+		r.inputs = append(r.inputs, in)
+	}
+	r.mu.Unlock()
+	return in, slog.New(warningHandler{Handler: log.Handler(), in: in})
+}
+
+// decoded records the decoding time of the source image.
+func (in *reportInput) decoded() {
+	if in == nil {
+		return
+	}
+	in.DecodeMS = milliseconds(time.Since(in.start))
+}
+
+// done records the output or error of the input.
+func (in *reportInput) done(out icon.Output, err error) {
+	if in == nil {
+		return
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.DurationMS = milliseconds(time.Since(in.start))
+	in.Out = out.Path
+	in.OutWidth, in.OutHeight = out.Width, out.Height
+	in.Size = out.Size
+	in.Background = out.Background
+	in.Skipped = out.Skipped
+	if !out.Trim.Empty() {
+		in.Trim = []int{out.Trim.Min.X, out.Trim.Min.Y, out.Trim.Max.X, out.Trim.Max.Y}
+	}
+	if err != nil {
+		in.Error = err.Error()
+	}
+}
+
+func (in *reportInput) warn(msg string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.Warnings = append(in.Warnings, msg)
+}
+
+// remove removes the input of the deleted source image.
+func (r *report) remove(src string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.sources, filepath.Clean(src))
+	r.mu.Unlock()
+}
+
+// flush writes all the inputs recorded since the report started to the report file.
+func (r *report) flush() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	inputs := make([]*reportInput, 0, len(r.inputs)+len(r.sources))
+	inputs = append(inputs, r.inputs...)
+	for _, in := range r.sources {
+		inputs = append(inputs, in)
+	}
+	started := r.started
+	r.mu.Unlock()
+
+	slices.SortStableFunc(inputs, func(a, b *reportInput) int {
+		if c := strings.Compare(a.Src, b.Src); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Out, b.Out)
+	})
+	file := reportFile{
+		Started:    started,
+		DurationMS: milliseconds(time.Since(started)),
+		Inputs:     inputs,
+	}
+	err := utils.WriteFileAtomic(r.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(file)
+	})
+	if err != nil {
+		slog.Error("Error writing report", slog.String("path", r.path), slog.Any("err", err))
+		return
+	}
+	slog.Info("Report written", slog.String("path", r.path), slog.Int("inputs", len(inputs)))
+}
+
+// milliseconds returns the duration in milliseconds, with microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// warningHandler forwards the records to the handler, recording the warnings and errors to the input.
+type warningHandler struct {
+	slog.Handler
+	in    *reportInput
+	attrs []slog.Attr
+}
+
+func (h warningHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		var sb strings.Builder
+		sb.WriteString(r.Message)
+		writeAttr := func(a slog.Attr) bool {
+			_, _ = fmt.Fprintf(&sb, " %s=%v", a.Key, a.Value)
+			return true
+		}
+		for _, a := range h.attrs {
+			writeAttr(a)
+		}
+		r.Attrs(writeAttr)
+		h.in.warn(sb.String())
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h warningHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warningHandler{
+		Handler: h.Handler.WithAttrs(attrs),
+		in:      h.in,
+		attrs:   append(slices.Clip(h.attrs), attrs...),
+	}
+}
+
+func (h warningHandler) WithGroup(name string) slog.Handler {
+	return warningHandler{Handler: h.Handler.WithGroup(name), in: h.in, attrs: h.attrs}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"github.com/mawngo/piconic/internal/server"
+	"github.com/mawngo/piconic/internal/utils"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+func newServeCommand() *cobra.Command {
+	cfg := server.Config{
+		Placeholder: icon.DefaultPlaceholderFlags(),
+		Icon: icon.Flags{
+			Size: 200,
+			OutputFlags: icon.OutputFlags{
+				Padding:    10,
+				Background: icon.AutoColor + "," + icon.BackgroundDefaultColor,
+				Trim:       icon.TransparentColor,
+			},
+		},
+		Limits: scan.Limits{
+			MaxPixels: 50_000_000,
+		},
+		MaxPixels: 4096 * 4096,
+		MaxAge:    24 * time.Hour,
+	}
+	addr := "localhost:8080"
+	cacheSize := "64MB"
+	maxFileSize := "10MB"
+	timeout := 30 * time.Second
+	command := cobra.Command{
+		Use:   "serve",
+		Short: "Serve placeholders and icons over http",
+		Long: "Serve placeholders at GET /{size}[/{bg}[/{fg}]][.format]?text=..., for example /300x250/Blue500/ffffff?text=hello.\n" +
+			"Icons are generated from the image uploaded to POST /icon, as the body or the file field of a form,\n" +
+			"with the options as query parameters, for example /icon?size=128&bg=transparent.",
+		Args: cobra.NoArgs,
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			var err error
+			if cfg.CacheSize, err = utils.ParseByteSize(cacheSize); err != nil {
+				return fmt.Errorf("invalid --cache-size %q: %w", cacheSize, err)
+			}
+			if cfg.Limits.MaxFileSize, err = utils.ParseByteSize(maxFileSize); err != nil {
+				return fmt.Errorf("invalid --max-file-size %q: %w", maxFileSize, err)
+			}
+			if cfg.Jobs <= 0 {
+				cfg.Jobs = runtime.NumCPU()
+			}
+			return nil
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			srv := &http.Server{
+				Addr:              addr,
+				Handler:           http.TimeoutHandler(server.New(cfg), timeout, "request timeout"),
+				ReadHeaderTimeout: 10 * time.Second,
+				ReadTimeout:       timeout,
+				MaxHeaderBytes:    1 << 16,
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				_ = srv.Shutdown(shutdownCtx)
+			}()
+
+			slog.Info("Serving", slog.String("addr", addr))
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			slog.Info("Server stopped")
+			return nil
+		},
+	}
+
+	command.Flags().StringVarP(&addr, "addr", "a", addr, "Address to listen on")
+	command.Flags().StringVar(&cacheSize, "cache-size", cacheSize, "Maximum size of the in-memory cache of generated images, for example 64MB (0 to disable)")
+	command.Flags().DurationVar(&cfg.MaxAge, "max-age", cfg.MaxAge, "Max age of the Cache-Control header")
+	command.Flags().IntVarP(&cfg.Jobs, "jobs", "j", cfg.Jobs, "Number of images to generate concurrently (0 for number of CPUs)")
+	command.Flags().DurationVar(&timeout, "timeout", timeout, "Timeout of a request")
+	command.Flags().Int64Var(&cfg.MaxPixels, "max-output-pixels", cfg.MaxPixels, "Reject request generating image having more pixels than this (0 for unlimited)")
+	command.Flags().Int64Var(&cfg.Limits.MaxPixels, "max-pixels", cfg.Limits.MaxPixels, "Reject uploaded image having more pixels than this (0 for unlimited)")
+	command.Flags().IntVar(&cfg.Limits.MaxWidth, "max-width", cfg.Limits.MaxWidth, "Reject uploaded image wider than this (0 for unlimited)")
+	command.Flags().IntVar(&cfg.Limits.MaxHeight, "max-height", cfg.Limits.MaxHeight, "Reject uploaded image taller than this (0 for unlimited)")
+	command.Flags().StringVar(&maxFileSize, "max-file-size", maxFileSize, "Reject uploaded file larger than this, for example 20MB (0 for unlimited)")
+	command.Flags().StringVarP(&cfg.Placeholder.Background, "bg", "b", cfg.Placeholder.Background, "Default placeholder background color ['auto', 'auto,fallback', 'transparent', hex, material, svg 1.1]")
+	command.Flags().StringVar(&cfg.Placeholder.Style, "style", cfg.Placeholder.Style, "Default placeholder background style")
+	command.Flags().StringVar(&cfg.Placeholder.Seed, "seed", cfg.Placeholder.Seed, "Seed of the placeholder 'auto' colors")
+	command.Flags().SortFlags = false
+	return &command
+}
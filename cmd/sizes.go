@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/spf13/cobra"
+	"text/tabwriter"
+)
+
+func newSizesCommand() *cobra.Command {
+	command := cobra.Command{
+		Use:   "sizes",
+		Short: "List placeholder size presets",
+		Long: "List the named sizes that can be used instead of WxH when generating placeholder.\n" +
+			"Sizes also accept aspect ratio with width, for example 16:9@1200, and density suffix, for example 300x250@2x.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			for _, p := range icon.PlaceholderPresets {
+				if _, err := fmt.Fprintf(w, "%s\t%dx%d\t%s\n", p.Name, p.W, p.H, p.Description); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+	return &command
+}
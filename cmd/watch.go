@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"github.com/mawngo/piconic/piconic"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often the watched files are polled.
+const watchInterval = 250 * time.Millisecond
+
+// watchDebounce is how long the files must stay unchanged before processing them,
+// so a burst of editor saves is processed once.
+const watchDebounce = 500 * time.Millisecond
+
+// watcher regenerates the icons of the changed sources and removes the icons of the deleted sources.
+// A nil watcher records nothing.
+type watcher struct {
+	out    icon.OutputFlags
+	opts   piconic.IconOptions
+	limits scan.Limits
+	pool   *pool
+	report *report
+
+	mu sync.Mutex
+	// outputs are the icon paths by source path.
+	outputs map[string]string
+}
+
+func newWatcher(out icon.OutputFlags, opts piconic.IconOptions, limits scan.Limits, p *pool, rep *report) *watcher {
+	return &watcher{
+		out:     out,
+		opts:    opts,
+		limits:  limits,
+		pool:    p,
+		report:  rep,
+		outputs: make(map[string]string),
+	}
+}
+
+// record returns the callback recording the icon of the source, or nil if the watcher is nil.
+func (w *watcher) record(src string) func(icon.Output, error) {
+	if w == nil {
+		return nil
+	}
+	return func(out icon.Output, err error) {
+		if err != nil || out.Path == "" {
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.outputs[filepath.Clean(src)] = filepath.Clean(out.Path)
+	}
+}
+
+// watch processes the changes of the paths until the context is done.
+// The icons of the changed sources are overwritten, whatever the --on-exist policy.
+func (w *watcher) watch(ctx context.Context, paths []string) {
+	out := w.out
+	out.OnExist = icon.OnExistOverwrite
+	slog.Info("Watching for changes", slog.Any("paths", paths))
+	for changes := range scan.Watch(ctx, paths, watchInterval, watchDebounce) {
+		now := time.Now()
+		processed := 0
+		for _, change := range changes {
+			// The icons written to the watched directories are changes too.
+			if w.isOutput(change.Path) {
+				continue
+			}
+			if change.Deleted {
+				w.remove(change.Path)
+				continue
+			}
+			for src := range scan.Img(change.Path, w.limits) {
+				processed++
+				if src.Err != nil {
+					reportScanError(src, w.report)
+					continue
+				}
+				processIcon(ctx, out, w.opts, src, w.pool, w.report, w.record(src.Path))
+			}
+		}
+		if processed == 0 {
+			continue
+		}
+		// Wait so the icons are recorded before their changes are polled.
+		w.pool.Wait()
+		slog.Info("Processing completed", slog.Int("images", processed), slog.Duration("took", time.Since(now)))
+		w.report.flush()
+	}
+	slog.Info("Watch stopped")
+}
+
+// isOutput reports whether the path is the icon of a source.
+func (w *watcher) isOutput(path string) bool {
+	path = filepath.Clean(path)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, out := range w.outputs {
+		if out == path {
+			return true
+		}
+	}
+	return false
+}
+
+// remove removes the icon of the deleted source, unless it is also the icon of another source,
+// and removes the source from the report.
+func (w *watcher) remove(src string) {
+	src = filepath.Clean(src)
+	w.report.remove(src)
+	w.mu.Lock()
+	out, ok := w.outputs[src]
+	delete(w.outputs, src)
+	w.mu.Unlock()
+	if !ok || w.isOutput(out) {
+		return
+	}
+
+	if err := os.Remove(out); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("Error removing image", slog.String("out", out), slog.Any("err", err))
+		return
+	}
+	slog.Info("Removed", slog.String("img", src), slog.String("out", out))
+}
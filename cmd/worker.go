@@ -0,0 +1,476 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"github.com/mawngo/piconic/internal/utils"
+	"github.com/mawngo/piconic/piconic"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WorkerJobIcon        = "icon"
+	WorkerJobPlaceholder = "placeholder"
+)
+
+var WorkerJobTypes = []string{WorkerJobIcon, WorkerJobPlaceholder}
+
+// maxWorkerJobSize is the maximum length of a job line.
+const maxWorkerJobSize = 16 << 20
+
+// workerJob is a line of the worker input.
+type workerJob struct {
+	// ID is echoed in the result, any json value.
+	ID   json.RawMessage `json:"id,omitempty"`
+	Type string          `json:"type"`
+	// Input is the image file or directory of the icon job.
+	Input string `json:"input"`
+	// Size and Text of the placeholder job.
+	Size  string          `json:"size"`
+	Text  string          `json:"text"`
+	Flags json.RawMessage `json:"flags"`
+}
+
+// workerFlags are the options of a job, named as the command line flags.
+type workerFlags struct {
+	Out           string   `json:"out"`
+	OnExist       string   `json:"on-exist"`
+	Overwrite     bool     `json:"overwrite"`
+	Size          int      `json:"size"`
+	Bg            string   `json:"bg"`
+	Fg            string   `json:"fg"`
+	Tint          bool     `json:"tint"`
+	Trim          string   `json:"trim"`
+	Padding       int      `json:"padding"`
+	Round         int      `json:"round"`
+	SrcRound      int      `json:"src-round"`
+	PadX          int      `json:"padx"`
+	PadY          int      `json:"pady"`
+	Name          string   `json:"name"`
+	Color         string   `json:"color"`
+	MaxLines      int      `json:"max-lines"`
+	MinFontSize   float64  `json:"min-font-size"`
+	LineHeight    float64  `json:"line-height"`
+	Style         string   `json:"style"`
+	PatternSize   int      `json:"pattern-size"`
+	Stroke        int      `json:"stroke"`
+	StrokeColor   string   `json:"stroke-color"`
+	Shadow        []int    `json:"shadow"`
+	ShadowColor   string   `json:"shadow-color"`
+	LetterSpacing float64  `json:"letter-spacing"`
+	Align         string   `json:"align"`
+	Valign        string   `json:"valign"`
+	Uppercase     bool     `json:"uppercase"`
+	Font          string   `json:"font"`
+	FontWeight    string   `json:"font-weight"`
+	FallbackFont  []string `json:"fallback-font"`
+	Format        string   `json:"format"`
+	Quality       int      `json:"quality"`
+	TargetSize    string   `json:"target-size"`
+	Seed          string   `json:"seed"`
+	MinContrast   float64  `json:"min-contrast"`
+}
+
+// defaultWorkerFlags returns the defaults of the job options, same as the command line.
+func defaultWorkerFlags() workerFlags {
+	f := piconic.DefaultIconOptions()
+	p := piconic.DefaultPlaceholderOptions(0, 0)
+	return workerFlags{
+		Out:         ".",
+		OnExist:     icon.OnExistSkip,
+		Size:        f.Size,
+		Bg:          f.Background,
+		Trim:        strings.Join(f.Trim, ","),
+		Padding:     f.Padding,
+		MaxLines:    p.MaxLines,
+		LineHeight:  p.LineHeight,
+		Style:       p.Style,
+		StrokeColor: p.StrokeColor,
+		ShadowColor: p.ShadowColor,
+		Align:       p.AlignX,
+		Valign:      p.AlignY,
+		FontWeight:  icon.FontWeightSemiBold,
+		Format:      icon.FormatPNG,
+		Quality:     icon.DefaultJPEGQuality,
+		TargetSize:  "0",
+	}
+}
+
+// iconOptions returns the rendering options of the icon job.
+func (jf workerFlags) iconOptions() piconic.IconOptions {
+	return piconic.IconOptions{
+		Size:       jf.Size,
+		Padding:    jf.Padding,
+		Round:      jf.Round,
+		SrcRound:   jf.SrcRound,
+		PadX:       jf.PadX,
+		PadY:       jf.PadY,
+		Background: jf.Bg,
+		Foreground: jf.Fg,
+		Tint:       jf.Tint,
+		Trim:       strings.Split(jf.Trim, ","),
+	}
+}
+
+// placeholderOptions returns the rendering options of the placeholder job, without the size and the text.
+func (jf workerFlags) placeholderOptions() piconic.PlaceholderOptions {
+	return piconic.PlaceholderOptions{
+		TextColor:     jf.Color,
+		Background:    jf.Bg,
+		Padding:       jf.Padding,
+		Round:         jf.Round,
+		Seed:          jf.Seed,
+		MinContrast:   jf.MinContrast,
+		MaxLines:      jf.MaxLines,
+		MinFontSize:   jf.MinFontSize,
+		LineHeight:    jf.LineHeight,
+		StrokeWidth:   jf.Stroke,
+		StrokeColor:   jf.StrokeColor,
+		ShadowColor:   jf.ShadowColor,
+		LetterSpacing: jf.LetterSpacing,
+		AlignX:        jf.Align,
+		AlignY:        jf.Valign,
+		Uppercase:     jf.Uppercase,
+		Style:         jf.Style,
+		PatternSize:   jf.PatternSize,
+	}
+}
+
+// workerOutput is an image written by a job.
+type workerOutput struct {
+	icon.Output
+	// Src is the source image of the icon.
+	Src   string `json:"src,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// workerResult is a line of the worker output.
+type workerResult struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	Outputs []workerOutput  `json:"outputs"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// maxWorkerFonts is the maximum number of fonts cached by the worker, the least recently used is evicted first.
+const maxWorkerFonts = 16
+
+// workerFont is the loaded font, and the size and modification time of its files when loaded.
+type workerFont struct {
+	font   *icon.Font
+	stamps []fontStamp
+}
+
+type fontStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s fontStamp) equal(o fontStamp) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+// worker runs the jobs and writes their results.
+type worker struct {
+	pool   *pool
+	limits scan.Limits
+	// fonts caches the loaded fonts by file, weight and fallbacks, so their faces stay warm across jobs.
+	// fontKeys orders the cached fonts from the least to the most recently used.
+	fonts    map[string]workerFont
+	fontKeys []string
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	wg  sync.WaitGroup
+}
+
+func newWorkerCommand() *cobra.Command {
+	pf := newPoolFlags()
+	maxFileSize := "0"
+	limits := scan.Limits{}
+	command := cobra.Command{
+		Use:   "worker",
+		Short: "Process json jobs read from stdin",
+		Long: "Read newline-delimited json jobs from stdin and write a json result line to stdout for each job.\n" +
+			`An icon job is {"id": 1, "type": "icon", "input": "logo.png", "flags": {"size": 128, "bg": "transparent"}},` + "\n" +
+			`a placeholder job is {"id": 2, "type": "placeholder", "size": "300x250@2x", "text": "hello", "flags": {"out": "dist"}},` + "\n" +
+			"the flags are named as the command line flags. Results are written in the order the jobs complete.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := pf.validate()
+			if err != nil {
+				return err
+			}
+			if limits.MaxFileSize, err = utils.ParseByteSize(maxFileSize); err != nil {
+				return fmt.Errorf("invalid --max-file-size %q: %w", maxFileSize, err)
+			}
+			w := &worker{
+				pool:   p,
+				limits: limits,
+				fonts:  make(map[string]workerFont),
+				enc:    json.NewEncoder(os.Stdout),
+			}
+			now := time.Now()
+			count, err := w.run(cmd.Context(), os.Stdin)
+			slog.Info("Worker stopped", slog.Int("jobs", count), slog.Duration("took", time.Since(now)))
+			return err
+		},
+	}
+
+	pf.register(&command)
+	command.Flags().Int64Var(&limits.MaxPixels, "max-pixels", limits.MaxPixels, "Reject source image having more pixels than this (0 for unlimited)")
+	command.Flags().IntVar(&limits.MaxWidth, "max-width", limits.MaxWidth, "Reject source image wider than this (0 for unlimited)")
+	command.Flags().IntVar(&limits.MaxHeight, "max-height", limits.MaxHeight, "Reject source image taller than this (0 for unlimited)")
+	command.Flags().StringVar(&maxFileSize, "max-file-size", maxFileSize, "Reject source file larger than this, for example 20MB (0 for unlimited)")
+	command.Flags().SortFlags = false
+	return &command
+}
+
+// run processes the jobs read from r until EOF, then waits for them to complete.
+// It returns the number of jobs read.
+// The images not yet admitted in the pool when the context is done fail with the error of the context.
+func (w *worker) run(ctx context.Context, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxWorkerJobSize)
+	count := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		count++
+		var job workerJob
+		if err := json.Unmarshal(line, &job); err != nil {
+			w.write(workerResult{Error: fmt.Sprintf("invalid job: %v", err)})
+			continue
+		}
+		if err := w.submit(ctx, job); err != nil {
+			w.write(workerResult{ID: job.ID, Error: err.Error()})
+		}
+	}
+	w.wg.Wait()
+	return count, scanner.Err()
+}
+
+// submit validates the job and runs its images in the pool.
+// The result is written once all the images of the job are written.
+func (w *worker) submit(ctx context.Context, job workerJob) error {
+	jf := defaultWorkerFlags()
+	if len(job.Flags) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(job.Flags))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&jf); err != nil {
+			return fmt.Errorf("invalid flags: %w", err)
+		}
+	}
+	out := icon.OutputFlags{Output: jf.Out, OnExist: jf.OnExist, Logger: job.logger()}
+	if out.Output == icon.StdoutOutput {
+		return errors.New("invalid out \"-\", stdout is used for the results")
+	}
+	if err := resolveOnExist(&out, jf.Overwrite); err != nil {
+		return err
+	}
+
+	res := &workerResult{ID: job.ID, Outputs: []workerOutput{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	// add reserves the output of an image and runs it in the pool.
+	add := func(cost int64, fn func() workerOutput) {
+		mu.Lock()
+		i := len(res.Outputs)
+		res.Outputs = append(res.Outputs, workerOutput{})
+		mu.Unlock()
+		wg.Add(1)
+		err := w.pool.Go(ctx, cost, func() {
+			defer wg.Done()
+			o := fn()
+			if o.Error != "" {
+				out.Logger.Error("Error processing image", slog.String("src", o.Src), slog.String("out", o.Path), slog.String("err", o.Error))
+			}
+			mu.Lock()
+			res.Outputs[i] = o
+			mu.Unlock()
+		})
+		if err != nil {
+			mu.Lock()
+			res.Outputs[i] = workerOutput{Error: err.Error()}
+			mu.Unlock()
+			wg.Done()
+		}
+	}
+
+	switch job.Type {
+	case WorkerJobIcon:
+		opts := jf.iconOptions()
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		if job.Input == "" || job.Input == scan.Stdin {
+			return fmt.Errorf("invalid input %q, must be an image file or directory", job.Input)
+		}
+		if !scan.IsGlyph(job.Input) {
+			if _, err := os.Stat(job.Input); err != nil {
+				return err
+			}
+		}
+		if !createOutputDir(out.Output) {
+			return fmt.Errorf("cannot create output directory %q", out.Output)
+		}
+		w.wg.Add(1)
+		go func() {
+			for src := range scan.Img(job.Input, w.limits) {
+				if src.Err != nil {
+					add(0, func() workerOutput {
+						return workerOutput{Src: src.Path, Error: fmt.Sprintf("scan: %v", src.Err)}
+					})
+					continue
+				}
+				add(iconMemory(opts, src), func() workerOutput {
+					img, err := src.Decode()
+					if err != nil {
+						return workerOutput{Src: src.Path, Error: fmt.Sprintf("decode: %v", err)}
+					}
+					o, err := writeIcon(ctx, out, opts, img)
+					return newWorkerOutput(src.Path, o, err)
+				})
+			}
+			w.finish(res, &wg)
+		}()
+	case WorkerJobPlaceholder:
+		sizes, ok := icon.ParsePlaceholderSize(strings.TrimSpace(job.Size))
+		if !ok {
+			return fmt.Errorf("invalid size %q", job.Size)
+		}
+		p := jf.placeholderOptions()
+		p.Text = strings.TrimSpace(job.Text)
+		file := placeholderFile{Name: jf.Name, Format: jf.Format, Quality: jf.Quality}
+		if err := checkPlaceholderFlags(&p, &file, jf.Shadow, jf.TargetSize); err != nil {
+			return err
+		}
+		var err error
+		if p.Font, err = w.font(jf.Font, jf.FontWeight, jf.FallbackFont); err != nil {
+			return fmt.Errorf("load font: %w", err)
+		}
+		opts := make([]piconic.PlaceholderOptions, 0, len(sizes))
+		for _, size := range sizes {
+			p.Width, p.Height, p.Density = size.W, size.H, size.Density
+			if err := p.Validate(); err != nil {
+				return err
+			}
+			opts = append(opts, p)
+		}
+		if !createOutputDir(out.Output) {
+			return fmt.Errorf("cannot create output directory %q", out.Output)
+		}
+		w.wg.Add(1)
+		for _, p := range opts {
+			add(placeholderMemory(p), func() workerOutput {
+				o, err := writePlaceholder(ctx, out, p, file)
+				return newWorkerOutput("", o, err)
+			})
+		}
+		go w.finish(res, &wg)
+	default:
+		return fmt.Errorf("invalid type %q, must be one of %s", job.Type, strings.Join(WorkerJobTypes, ", "))
+	}
+	return nil
+}
+
+// logger returns the default logger with the id of the job, or a new id if the job has none.
+func (job workerJob) logger() *slog.Logger {
+	if len(job.ID) == 0 {
+		return jobLogger()
+	}
+	var id string
+	if err := json.Unmarshal(job.ID, &id); err != nil {
+		id = string(job.ID)
+	}
+	return slog.With(slog.String("job", id))
+}
+
+// finish writes the result once the images of the job are written.
+func (w *worker) finish(res *workerResult, wg *sync.WaitGroup) {
+	defer w.wg.Done()
+	wg.Wait()
+	w.write(*res)
+}
+
+func (w *worker) write(res workerResult) {
+	if res.Outputs == nil {
+		res.Outputs = []workerOutput{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(res); err != nil {
+		slog.Error("Error writing result", slog.Any("err", err))
+	}
+}
+
+// font returns the cached font, or nil for the default font.
+// The cached font is reloaded when one of its files is modified.
+// Only the reading goroutine loads fonts, so the cache is not locked.
+func (w *worker) font(file string, weight string, fallbacks []string) (*icon.Font, error) {
+	if file == "" && weight == icon.FontWeightSemiBold && len(fallbacks) == 0 {
+		return nil, nil
+	}
+	files := fallbacks
+	if file != "" {
+		files = append([]string{file}, fallbacks...)
+	}
+	key := weight + "\x00" + strings.Join(files, "\x00")
+	stamps := statFontFiles(files)
+	if cached, ok := w.fonts[key]; ok && stamps != nil && slices.EqualFunc(cached.stamps, stamps, fontStamp.equal) {
+		w.touchFont(key)
+		return cached.font, nil
+	}
+	f, err := icon.LoadFont(file, weight, fallbacks)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := w.fonts[key]; !ok && len(w.fonts) >= maxWorkerFonts {
+		delete(w.fonts, w.fontKeys[0])
+		w.fontKeys = w.fontKeys[1:]
+	}
+	w.fonts[key] = workerFont{font: f, stamps: stamps}
+	w.touchFont(key)
+	return f, nil
+}
+
+// touchFont marks the cached font as the most recently used.
+func (w *worker) touchFont(key string) {
+	w.fontKeys = slices.DeleteFunc(w.fontKeys, func(k string) bool { return k == key })
+	w.fontKeys = append(w.fontKeys, key)
+}
+
+// statFontFiles returns the size and modification time of the font files, nil if one cannot be read.
+func statFontFiles(files []string) []fontStamp {
+	stamps := make([]fontStamp, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil
+		}
+		stamps = append(stamps, fontStamp{size: info.Size(), modTime: info.ModTime()})
+	}
+	return stamps
+}
+
+func newWorkerOutput(src string, o icon.Output, err error) workerOutput {
+	out := workerOutput{Output: o, Src: src}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
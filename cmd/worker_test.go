@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerScanError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := &worker{pool: newPool(1, 0), enc: json.NewEncoder(&buf)}
+	job := fmt.Sprintf(`{"id":"a","type":"icon","input":%q,"flags":{"out":%q}}`, dir, t.TempDir())
+	if _, err := w.run(context.Background(), strings.NewReader(job)); err != nil {
+		t.Fatal(err)
+	}
+
+	var res workerResult
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.ID) != `"a"` || len(res.Outputs) != 1 {
+		t.Fatalf("expected one output of job a, got %s", buf.String())
+	}
+	if out := res.Outputs[0]; out.Src != filepath.Join(dir, "notes.txt") || !strings.HasPrefix(out.Error, "scan: ") {
+		t.Errorf("expected scan error of notes.txt, got %+v", out)
+	}
+}
+
+func TestWorkerFontCache(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "internal", "icon", "Roboto-SemiBold.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "font.ttf")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := &worker{fonts: make(map[string]workerFont)}
+	font := func(fallbacks int) *icon.Font {
+		f, err := w.font(file, icon.FontWeightSemiBold, slices.Repeat([]string{file}, fallbacks))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	first := font(0)
+	if font(0) != first {
+		t.Error("expected the cached font")
+	}
+	modified := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	if font(0) == first {
+		t.Error("expected the modified font to be reloaded")
+	}
+
+	for i := range maxWorkerFonts + 4 {
+		font(i)
+	}
+	if len(w.fonts) != maxWorkerFonts || len(w.fontKeys) != maxWorkerFonts {
+		t.Errorf("expected %d cached fonts, got %d and %d keys", maxWorkerFonts, len(w.fonts), len(w.fontKeys))
+	}
+	// The least recently used fonts are evicted.
+	if _, ok := w.fonts[icon.FontWeightSemiBold+"\x00"+file]; ok {
+		t.Error("expected the least recently used font to be evicted")
+	}
+}
@@ -0,0 +1,134 @@
+package icon
+
+import (
+	"context"
+	"fmt"
+	matcolornames "golang.org/x/exp/shiny/materialdesign/colornames"
+	"golang.org/x/image/draw"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"log/slog"
+	"strings"
+	"unicode"
+)
+
+// Shapes of the avatar.
+const (
+	ShapeSquare = "square"
+	ShapeCircle = "circle"
+)
+
+var Shapes = []string{ShapeSquare, ShapeCircle}
+
+// avatarShades of the material colors used as the avatar background.
+var avatarShades = []string{"500", "600", "700"}
+
+// avatarColors is the palette of the auto avatar background.
+var avatarColors = func() []string {
+	colors := make([]string, 0, len(matcolornames.Names))
+	for _, name := range matcolornames.Names {
+		for _, shade := range avatarShades {
+			if strings.HasSuffix(name, shade) && !strings.HasSuffix(name, "A"+shade) {
+				colors = append(colors, name)
+			}
+		}
+	}
+	return colors
+}()
+
+type AvatarFlags struct {
+	OutputFlags
+	Size      uint
+	TextColor string
+	Shape     string
+}
+
+// EstimateMemory returns the approximate bytes needed to generate the avatar.
+func (f AvatarFlags) EstimateMemory() int64 {
+	return int64(f.Size) * int64(f.Size) * bytesPerPixel
+}
+
+// WriteAvatar generates the avatar with the initials of the name.
+// The auto background color is chosen from a hash of the name, so the same name always has the same avatar.
+func WriteAvatar(f AvatarFlags, name string) (out Output, err error) {
+	initials := Initials(name)
+	log := f.logger()
+	log.Info("Processing",
+		slog.String("name", name),
+		slog.String("initials", initials),
+		slog.String("bg", f.Background),
+		slog.Any("size", f.Size),
+	)
+
+	outName := fmt.Sprintf("%s.avatar%dpc%d.png", filenameNormalizer.Replace(strings.TrimSpace(name)), f.Size, f.Padding)
+	outfile, release, ok := ReserveOutFile(f.OutputFlags, outName, "")
+	if !ok {
+		return Output{Path: outfile, Skipped: true}, nil
+	}
+	defer func() { release(err) }()
+
+	bgColor := calculateAvatarBackgroundColor(log, f.Background, name)
+	textColor := calculateAvatarTextColor(log, f.TextColor, bgColor)
+
+	pf := PlaceholderFlags{
+		OutputFlags: f.OutputFlags,
+		W:           int(f.Size),
+		H:           int(f.Size),
+	}
+	if f.Shape == ShapeCircle {
+		pf.Round = 100
+	}
+	img := image.NewRGBA(image.Rect(0, 0, pf.W, pf.H))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bgColor}, image.Point{}, draw.Src)
+	if initials != "" {
+		if err := drawText(context.Background(), pf, img, initials, textColor); err != nil {
+			return Output{Path: outfile}, err
+		}
+	}
+	out = Output{Path: outfile, Width: pf.W, Height: pf.H, Background: FormatOutputColor(bgColor)}
+	out.Size, err = writeOutImage(pf.OutputFlags, outfile, img)
+	return out, err
+}
+
+// Initials returns the uppercase first letters of the first and the last word of the name.
+// For email, only the part before @ is used.
+func Initials(name string) string {
+	name, _, _ = strings.Cut(strings.TrimSpace(name), "@")
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	first := []rune(words[0])[0]
+	if len(words) == 1 {
+		return string(unicode.ToUpper(first))
+	}
+	last := []rune(words[len(words)-1])[0]
+	return string(unicode.ToUpper(first)) + string(unicode.ToUpper(last))
+}
+
+// hashName returns a hash of the name, ignoring case and surrounding spaces.
+func hashName(name string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(strings.TrimSpace(name))))
+	return h.Sum32()
+}
+
+func calculateAvatarBackgroundColor(log *slog.Logger, bg string, name string) color.Color {
+	if strings.HasPrefix(bg, AutoColor) {
+		return matcolornames.Map[avatarColors[hashName(name)%uint32(len(avatarColors))]]
+	}
+	return calculatePlaceholderBackgroundColor(log, bg)
+}
+
+func calculateAvatarTextColor(log *slog.Logger, textColor string, bg color.Color) color.Color {
+	if textColor == "" {
+		textColor = AutoColor
+	}
+	if c := calculateForegroundColor(log, textColor, bg); c != nil {
+		return c
+	}
+	return contrastColor(bg)
+}
@@ -0,0 +1,34 @@
+package icon
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestInitials(t *testing.T) {
+	tests := []struct {
+		name string
+		exp  string
+	}{
+		{name: "Jane Doe", exp: "JD"},
+		{name: "  jane   van der doe ", exp: "JD"},
+		{name: "john.smith@example.com", exp: "JS"},
+		{name: "madonna", exp: "M"},
+		{name: "ánh nguyễn", exp: "ÁN"},
+		{name: "--", exp: ""},
+	}
+
+	for _, test := range tests {
+		if got := Initials(test.name); got != test.exp {
+			t.Errorf("%q: expected %q, got %q", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestCalculateAvatarBackgroundColorDeterministic(t *testing.T) {
+	c1 := calculateAvatarBackgroundColor(slog.Default(), AutoColor, "Jane Doe")
+	c2 := calculateAvatarBackgroundColor(slog.Default(), AutoColor, " jane doe")
+	if c1 != c2 {
+		t.Errorf("expected same color for same name, got %v and %v", c1, c2)
+	}
+}
@@ -0,0 +1,344 @@
+package icon
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxCachedFaces is the number of faces kept in the cache, the cache is reset when exceeded.
+const maxCachedFaces = 256
+
+// Weights of the embedded Roboto font.
+const (
+	FontWeightRegular  = "regular"
+	FontWeightMedium   = "medium"
+	FontWeightSemiBold = "semibold"
+	FontWeightBold     = "bold"
+)
+
+var FontWeights = []string{FontWeightRegular, FontWeightMedium, FontWeightSemiBold, FontWeightBold}
+
+var (
+	ErrInvalidFont       = errors.New("invalid font")
+	ErrUnknownFontWeight = errors.New("unknown font weight")
+)
+
+var (
+	//go:embed Roboto-Regular.ttf
+	robotoRegular []byte
+	//go:embed Roboto-Medium.ttf
+	robotoMedium []byte
+	//go:embed Roboto-SemiBold.ttf
+	robotoSemiBold []byte
+	// robotoBold is Roboto Bold Italic 2.138 with its 12° slant removed, as the upright Roboto Bold is not vendored.
+	//go:embed Roboto-Bold.ttf
+	robotoBold []byte
+)
+
+// embeddedFont is an embedded Roboto font and its css weight.
+type embeddedFont struct {
+	data   []byte
+	weight int
+}
+
+// embeddedFonts by weight.
+var embeddedFonts = map[string]embeddedFont{
+	FontWeightRegular:  {data: robotoRegular, weight: 400},
+	FontWeightMedium:   {data: robotoMedium, weight: 500},
+	FontWeightSemiBold: {data: robotoSemiBold, weight: 600},
+	FontWeightBold:     {data: robotoBold, weight: 700},
+}
+
+var fontFamilyEscaper = strings.NewReplacer(`'`, "", `"`, "", "&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// defaultFont is used when the flags do not specify a font.
+var defaultFont *Font
+
+func init() {
+	var err error
+	if defaultFont, err = NewFont(robotoSemiBold); err != nil {
+		panic(err)
+	}
+	defaultFont.weight = embeddedFonts[FontWeightSemiBold].weight
+}
+
+// Font is a list of fonts used to draw text.
+// Each rune is drawn using the first font having its glyph, so the later fonts are fallbacks of the earlier ones.
+type Font struct {
+	fonts []*sfnt.Font
+	faces faceCache
+	// weight of the primary font in css, 0 if unknown.
+	weight int
+}
+
+// NewFont parses the TTF/OTF fonts, the first font is the primary font.
+func NewFont(data ...[]byte) (*Font, error) {
+	f := &Font{faces: faceCache{faces: make(map[float64]*cachedFace)}}
+	for _, d := range data {
+		parsed, err := parseFont(d)
+		if err != nil {
+			return nil, err
+		}
+		f.fonts = append(f.fonts, parsed)
+	}
+	if len(f.fonts) == 0 {
+		return nil, fmt.Errorf("%w: no font", ErrInvalidFont)
+	}
+	return f, nil
+}
+
+// LoadFont loads the font from the file, falling back to the fallback files then the embedded Roboto of the weight.
+// If the file is empty, the embedded Roboto of the weight is the primary font, falling back to the fallback files.
+func LoadFont(file string, weight string, fallbacks []string) (*Font, error) {
+	embedded, ok := embeddedFonts[weight]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFontWeight, weight)
+	}
+
+	var data [][]byte
+	files := fallbacks
+	if file != "" {
+		files = append([]string{file}, fallbacks...)
+	} else {
+		data = append(data, embedded.data)
+	}
+	for _, path := range files {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parseFont(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		data = append(data, b)
+	}
+	if file != "" {
+		data = append(data, embedded.data)
+	}
+	f, err := NewFont(data...)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		f.weight = embedded.weight
+	}
+	return f, nil
+}
+
+// missing returns the characters of the text missing from all the fonts, which are drawn as empty boxes.
+func (f *Font) missing(text string) string {
+	var buf sfnt.Buffer
+	var missing []rune
+	for _, r := range text {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || slices.Contains(missing, r) {
+			continue
+		}
+		found := false
+		for _, fnt := range f.fonts {
+			if idx, err := fnt.GlyphIndex(&buf, r); err == nil && idx != 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return string(missing)
+}
+
+// parseFont parses a font or the first font of a collection.
+func parseFont(data []byte) (*sfnt.Font, error) {
+	f, err := sfnt.Parse(data)
+	if err == nil {
+		return f, nil
+	}
+	c, cerr := sfnt.ParseCollection(data)
+	if cerr != nil || c.NumFonts() == 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFont, err)
+	}
+	if f, err = c.Font(0); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFont, err)
+	}
+	return f, nil
+}
+
+// family returns the quoted family name of the primary font for css, empty if the font has no name.
+// The typographic family is preferred, as the family of the fonts other than regular and bold includes their weight.
+func (f *Font) family() string {
+	var buf sfnt.Buffer
+	name, err := f.fonts[0].Name(&buf, sfnt.NameIDTypographicFamily)
+	if err != nil || name == "" {
+		name, err = f.fonts[0].Name(&buf, sfnt.NameIDFamily)
+	}
+	if err != nil || name == "" {
+		return ""
+	}
+	return "'" + fontFamilyEscaper.Replace(name) + "'"
+}
+
+// face returns the cached face of the size, safe for concurrent use.
+func (f *Font) face(size float64) *cachedFace {
+	return f.faces.get(f, size)
+}
+
+// faceCache caches the faces of a font and their metrics by size, safe for concurrent use.
+type faceCache struct {
+	mu    sync.Mutex
+	faces map[float64]*cachedFace
+}
+
+// cachedFace is a face with its metrics.
+// The face is not safe for concurrent use, so it is guarded by a mutex.
+type cachedFace struct {
+	mu   sync.Mutex
+	face font.Face
+	// height of a line, in pixel.
+	height float64
+}
+
+func (c *faceCache) get(f *Font, size float64) *cachedFace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cf, ok := c.faces[size]; ok {
+		return cf
+	}
+	if len(c.faces) >= maxCachedFaces {
+		clear(c.faces)
+	}
+	face := newFallbackFace(f.fonts, size)
+	cf := &cachedFace{
+		face:   face,
+		height: float64(face.Metrics().Height) / 64,
+	}
+	c.faces[size] = cf
+	return cf
+}
+
+// measure returns the advance width of the string, in pixel.
+func (f *cachedFace) measure(s string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return float64(font.MeasureString(f.face, s)) / 64
+}
+
+// bound returns the bounds and the advance width of the string.
+func (f *cachedFace) bound(s string) (fixed.Rectangle26_6, fixed.Int26_6) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return font.BoundString(f.face, s)
+}
+
+// draw draws the string with its baseline starting at dot, adding spacing between characters.
+func (f *cachedFace) draw(dst draw.Image, src image.Image, dot fixed.Point26_6, s string, spacing fixed.Int26_6) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev := rune(-1)
+	for _, r := range s {
+		if prev >= 0 {
+			dot.X += f.face.Kern(prev, r) + spacing
+		}
+		dr, mask, maskp, advance, ok := f.face.Glyph(dot, r)
+		if ok {
+			draw.DrawMask(dst, dr, src, image.Point{}, mask, maskp, draw.Over)
+		}
+		dot.X += advance
+		prev = r
+	}
+}
+
+// fallbackFace uses the face of the first font having the glyph of each rune.
+// The advances and kerning are memoized, as the text is measured many times while fitting.
+type fallbackFace struct {
+	fonts    []*sfnt.Font
+	faces    []font.Face
+	buf      sfnt.Buffer
+	advances map[rune]fixed.Int26_6
+	kerns    map[[2]rune]fixed.Int26_6
+}
+
+func newFallbackFace(fonts []*sfnt.Font, size float64) *fallbackFace {
+	f := &fallbackFace{
+		fonts:    fonts,
+		advances: make(map[rune]fixed.Int26_6),
+		kerns:    make(map[[2]rune]fixed.Int26_6),
+	}
+	for _, fnt := range fonts {
+		face, err := opentype.NewFace(fnt, &opentype.FaceOptions{
+			Size: size,
+			DPI:  72,
+		})
+		if err != nil {
+			// Only happens with invalid options.
+			panic(err)
+		}
+		f.faces = append(f.faces, face)
+	}
+	return f
+}
+
+// faceOf returns the face having the glyph of the rune, or the primary face if no face has it.
+func (f *fallbackFace) faceOf(r rune) font.Face {
+	for i, fnt := range f.fonts {
+		if idx, err := fnt.GlyphIndex(&f.buf, r); err == nil && idx != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	var errs []error
+	for _, face := range f.faces {
+		errs = append(errs, face.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faceOf(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faceOf(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	if adv, ok := f.advances[r]; ok {
+		return adv, true
+	}
+	adv, ok := f.faceOf(r).GlyphAdvance(r)
+	if ok {
+		f.advances[r] = adv
+	}
+	return adv, ok
+}
+
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if k, ok := f.kerns[[2]rune{r0, r1}]; ok {
+		return k
+	}
+	var k fixed.Int26_6
+	if face := f.faceOf(r0); face == f.faceOf(r1) {
+		k = face.Kern(r0, r1)
+	}
+	f.kerns[[2]rune{r0, r1}] = k
+	return k
+}
+
+// Metrics returns the metrics of the primary face.
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
@@ -0,0 +1,75 @@
+package icon
+
+import (
+	"errors"
+	"golang.org/x/image/font/gofont/goregular"
+	"testing"
+)
+
+func TestFallbackFace(t *testing.T) {
+	f, err := LoadFont("", FontWeightSemiBold, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withFallback, err := NewFont(embeddedFonts[FontWeightSemiBold].data, goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The arrow is missing from the default font, but available in the Go font.
+	face := withFallback.face(32).face.(*fallbackFace)
+	if face.faceOf('→') != face.faces[1] {
+		t.Errorf("expected fallback face for missing glyph")
+	}
+	if face.faceOf('A') != face.faces[0] {
+		t.Errorf("expected primary face for available glyph")
+	}
+	if got, exp := withFallback.face(32).height, f.face(32).height; got != exp {
+		t.Errorf("expected metrics of the primary font %.2f, got %.2f", exp, got)
+	}
+}
+
+func TestLoadFontWeight(t *testing.T) {
+	tests := []struct {
+		weight string
+		exp    int
+		err    error
+	}{
+		{weight: FontWeightRegular, exp: 400},
+		{weight: FontWeightMedium, exp: 500},
+		{weight: FontWeightSemiBold, exp: 600},
+		{weight: FontWeightBold, exp: 700},
+		{weight: "thin", err: ErrUnknownFontWeight},
+	}
+
+	for _, test := range tests {
+		f, err := LoadFont("", test.weight, nil)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", test.weight, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if f.weight != test.exp || f.family() != "'Roboto'" {
+			t.Errorf("%s: expected Roboto %d, got %s %d", test.weight, test.exp, f.family(), f.weight)
+		}
+	}
+}
+
+func TestFontMissing(t *testing.T) {
+	tests := []struct {
+		text string
+		exp  string
+	}{
+		{text: "Hello", exp: ""},
+		{text: "Tiếng Việt\nПривет", exp: ""},
+		{text: "你好 Hello 你", exp: "你好"},
+	}
+
+	for _, test := range tests {
+		if got := defaultFont.missing(test.text); got != test.exp {
+			t.Errorf("%q: expected %q missing, got %q", test.text, test.exp, got)
+		}
+	}
+}
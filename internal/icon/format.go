@@ -0,0 +1,154 @@
+package icon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mawngo/piconic/internal/utils"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Output formats of the placeholder.
+const (
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatSVG  = "svg"
+)
+
+var PlaceholderFormats = []string{FormatPNG, FormatJPEG, FormatGIF, FormatBMP, FormatSVG}
+
+// DefaultJPEGQuality is the JPEG quality when not specified.
+const DefaultJPEGQuality = 90
+
+// FormatExt returns the file extension of the format.
+func FormatExt(format string) string {
+	switch format {
+	case "", FormatPNG:
+		return ".png"
+	case FormatJPEG:
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// EncodeImage encodes the image in the raster format, empty for png.
+func EncodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case "", FormatPNG:
+		return png.Encode(w, img)
+	case FormatJPEG:
+		if quality <= 0 {
+			quality = DefaultJPEGQuality
+		}
+		return jpeg.Encode(w, flattenImage(img), &jpeg.Options{Quality: quality})
+	case FormatGIF:
+		return gif.Encode(w, img, nil)
+	case FormatBMP:
+		return bmp.Encode(w, img)
+	}
+	return fmt.Errorf("%w: %s", utils.ErrFormatNotSupported, format)
+}
+
+// flattenImage draws the image over white, for formats without alpha.
+func flattenImage(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
+var stdoutMu sync.Mutex
+
+// WriteOutFile writes the encoded file, padded to the target size if it is positive.
+// The file is written to stdout if the outfile is StdoutOutput. It returns the size of the written file.
+func WriteOutFile(log *slog.Logger, outfile string, format string, targetSize int64, encode func(w io.Writer) error) (int64, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		return 0, fmt.Errorf("encode: %w", err)
+	}
+	data := buf.Bytes()
+	if targetSize > 0 {
+		if int64(len(data)) > targetSize {
+			log.Warn("File is larger than the target size",
+				slog.String("out", outfile),
+				slog.Int("size", len(data)),
+				slog.Int64("target", targetSize))
+		} else {
+			data = padFile(data, format, int(targetSize))
+		}
+	}
+
+	if outfile == StdoutOutput {
+		// Images written concurrently must not be interleaved.
+		stdoutMu.Lock()
+		defer stdoutMu.Unlock()
+		_, err := os.Stdout.Write(data)
+		return int64(len(data)), err
+	}
+	return int64(len(data)), utils.WriteFileAtomic(outfile, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// padFile pads the encoded file to the size, keeping it valid for the format.
+// PNG is padded with an ancillary chunk, JPEG with comment segments, SVG with a comment,
+// others with trailing zero bytes which the decoders ignore.
+func padFile(data []byte, format string, size int) []byte {
+	n := size - len(data)
+	switch format {
+	case "", FormatPNG:
+		// A chunk has 12 bytes of length, type and crc, inserted before the IEND chunk.
+		const overhead = 12
+		if n < overhead || len(data) < overhead {
+			break
+		}
+		chunk := make([]byte, n)
+		binary.BigEndian.PutUint32(chunk, uint32(n-overhead))
+		copy(chunk[4:], "paDd")
+		binary.BigEndian.PutUint32(chunk[n-4:], crc32.ChecksumIEEE(chunk[4:n-4]))
+		end := len(data) - overhead
+		return append(append(data[:end:end], chunk...), data[end:]...)
+	case FormatJPEG:
+		// Comment segments are inserted after the SOI marker, each has 4 bytes of marker and length.
+		const overhead, maxSegment = 4, 0xffff + 2
+		if n < overhead || len(data) < 2 {
+			break
+		}
+		padding := make([]byte, 0, n)
+		for n > 0 {
+			segment := min(n, maxSegment)
+			// The last segment must be able to hold its own overhead.
+			if rest := n - segment; rest > 0 && rest < overhead {
+				segment -= overhead
+			}
+			padding = append(padding, 0xff, 0xfe)
+			padding = binary.BigEndian.AppendUint16(padding, uint16(segment-2))
+			padding = append(padding, make([]byte, segment-overhead)...)
+			n -= segment
+		}
+		return append(append(data[:2:2], padding...), data[2:]...)
+	case FormatSVG:
+		// A comment has 7 bytes of <!-- and -->.
+		const overhead = 7
+		if n < overhead {
+			return append(data, bytes.Repeat([]byte{'\n'}, n)...)
+		}
+		return append(append(append(data, "<!--"...), bytes.Repeat([]byte{' '}, n-overhead)...), "-->"...)
+	}
+	return append(data, make([]byte, n)...)
+}
@@ -0,0 +1,46 @@
+package icon
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPadFile(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(10, 10, color.RGBA{R: 0xff, A: 0xff})
+
+	tests := []struct {
+		format string
+		size   int
+	}{
+		{format: FormatPNG, size: 4096},
+		{format: FormatJPEG, size: 4096},
+		{format: FormatJPEG, size: 200_000},
+		{format: FormatGIF, size: 4096},
+		{format: FormatBMP, size: 8192},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeImage(&buf, img, tt.format, 0); err != nil {
+				t.Fatal(err)
+			}
+			data := padFile(buf.Bytes(), tt.format, tt.size)
+			if len(data) != tt.size {
+				t.Fatalf("size = %d, want %d", len(data), tt.size)
+			}
+			decoded, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode padded file: %v", err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Errorf("bounds = %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+		})
+	}
+}
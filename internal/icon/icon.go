@@ -1,6 +1,8 @@
 package icon
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/mawngo/piconic/internal/colorcmp"
 	"github.com/mawngo/piconic/internal/scan"
@@ -11,6 +13,8 @@
 	"image"
 	"image/color"
 	"image/png"
+	"io"
+	"io/fs"
 	"log/slog"
 	"math"
 	"os"
@@ -24,54 +28,156 @@
 	TransparentColor       = "transparent"
 )
 
+// Policies applied when the output file already exists.
+const (
+	OnExistSkip      = "skip"
+	OnExistOverwrite = "overwrite"
+	OnExistRename    = "rename"
+	OnExistNewer     = "newer"
+)
+
+// StdoutOutput is the output writing the images to stdout instead of files.
+const StdoutOutput = "-"
+
+// bytesPerPixel of the RGBA images used when processing.
+const bytesPerPixel = 4
+
+var OnExistPolicies = []string{OnExistSkip, OnExistOverwrite, OnExistRename, OnExistNewer}
+
 type OutputFlags struct {
 	Output     string
 	Padding    uint
 	Round      uint
-	Overwrite  bool
+	OnExist    string
 	Background string
 	Trim       string
 	PadX       int
 	PadY       int
+	// Logger receives the warnings and the debug logs of the rendering, nil for the default logger.
+	Logger *slog.Logger
+}
+
+func (f OutputFlags) logger() *slog.Logger {
+	if f.Logger == nil {
+		return slog.Default()
+	}
+	return f.Logger
+}
+
+// Output is the image written by the Write functions.
+type Output struct {
+	// Path of the output file, StdoutOutput for stdout.
+	Path   string `json:"path"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// Background color of the image in hex, or transparent.
+	Background string `json:"bg,omitempty"`
+	// Size of the written file in bytes.
+	Size int64 `json:"size,omitempty"`
+	// Trim is the area of the source image kept after trimming, empty for placeholders.
+	Trim image.Rectangle `json:"-"`
+	// Skipped is true if the output file exists and is kept.
+	Skipped bool `json:"skipped,omitempty"`
 }
 
 type Flags struct {
 	OutputFlags
 	Size     uint
 	SrcRound uint
+	// Foreground recolors the source image, empty to keep the original colors.
+	Foreground string
+	// Tint multiplies the source colors with the Foreground instead of replacing them.
+	Tint bool
 }
 
-func WriteIcon(f Flags, img scan.DecodedImage) {
-	slog.Info("Processing",
-		slog.String("img", filepath.Base(img.Path)),
-		slog.String("dimension", fmt.Sprintf("%dx%d", img.Width, img.Height)),
-		slog.String("bg", f.Background),
-		slog.Any("size", f.Size),
-	)
+// EncodeIcon renders the icon of the image and encodes it as png.
+// Rendering stops with the error of the context when it is done.
+func EncodeIcon(ctx context.Context, w io.Writer, f Flags, img scan.DecodedImage) error {
+	out, err := RenderIcon(ctx, f, img)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return png.Encode(w, out)
+}
 
-	outName := fmt.Sprintf("%s.%dpc%d.png", strings.TrimSuffix(filepath.Base(img.Path), filepath.Ext(img.Path)), f.Size, f.Padding)
-	outfile, ok := canWriteOutImage(f.OutputFlags, outName)
-	if !ok {
-		return
+// RenderIcon renders the icon of the image.
+// The context is checked between the steps, stopping with its error when it is done.
+func RenderIcon(ctx context.Context, f Flags, img scan.DecodedImage) (*image.RGBA, error) {
+	out, _, _, err := RenderIconDetails(ctx, f, img)
+	return out, err
+}
+
+// RenderIconDetails renders the icon of the image like RenderIcon,
+// also returning the background color and the trimmed area of the source, as they may be detected from the image.
+func RenderIconDetails(ctx context.Context, f Flags, img scan.DecodedImage) (*image.RGBA, color.Color, image.Rectangle, error) {
+	out, bgColor, trim, err := renderIcon(ctx, f, img)
+	if err != nil {
+		return nil, nil, trim, err
 	}
+	if f.Round > 0 {
+		if err := utils.RoundImage(out, float64(f.Round)/100); err != nil {
+			return nil, nil, trim, err
+		}
+	}
+	return out, bgColor, trim, nil
+}
 
-	bgColor, rect := calculateTargetRect(f, img)
-	img = resize(f, img, rect)
+// renderIcon draws the resized image over the background, without the output rounding.
+// The background color and the trimmed area of the source are also returned, as they may be detected from the image.
+func renderIcon(ctx context.Context, f Flags, img scan.DecodedImage) (*image.RGBA, color.Color, image.Rectangle, error) {
+	var bgColor color.Color
+	var rect image.Rectangle
+	if img.Vector != nil {
+		bgColor, rect, img = renderVector(f, img)
+	} else {
+		bgColor, rect = calculateTargetRect(f, img)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, rect, err
+		}
+		img = resize(f, img, rect)
+		if fgColor := calculateForegroundColor(f.logger(), f.Foreground, bgColor); fgColor != nil {
+			utils.Recolor(img.Image.(*image.RGBA), fgColor, f.Tint)
+		}
+	}
 	if f.SrcRound > 0 {
 		err := utils.RoundImage(img.Image, float64(f.SrcRound)/100)
 		if err != nil {
-			slog.Warn("Source format does not support rounding", slog.String("out", outfile))
+			f.logger().Warn("Source format does not support rounding", slog.String("path", img.Path))
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, nil, rect, err
+	}
+
 	bgImg := image.NewRGBA(image.Rect(0, 0, int(f.Size), int(f.Size)))
 	draw.Draw(bgImg, bgImg.Bounds(), &image.Uniform{C: bgColor}, image.Point{}, draw.Src)
 
 	offset := image.Pt((int(f.Size)-img.Width)/2, (int(f.Size)-img.Height)/2)
 	offset = offset.Add(image.Pt(int(math.RoundToEven((float64(f.PadX)/100)*float64(f.Size))), int(math.RoundToEven((float64(f.PadY)/100)*float64(f.Size)))))
-	slog.Debug("Padding", slog.Int("x", offset.X), slog.Int("y", offset.Y))
+	f.logger().Debug("Padding", slog.Int("x", offset.X), slog.Int("y", offset.Y))
 	draw.Draw(bgImg, bgImg.Bounds().Add(offset), img.Image, image.Point{}, draw.Over)
-	writeOutImage(f.OutputFlags, outName, bgImg)
+	return bgImg, bgColor, rect, nil
+}
+
+// EstimateMemory returns the approximate bytes needed to generate the icon from the source image.
+func (f Flags) EstimateMemory(src scan.Source) int64 {
+	output := int64(f.Size) * int64(f.Size)
+	if src.Vector {
+		// The vector is rendered for trimming at a higher resolution than the output, whatever its dimension.
+		side := int64(min(float64(f.Size)*vectorTrimScale, maxVectorTrimSize))
+		return (side*side + output*2) * bytesPerPixel
+	}
+	// The decoded source, the resized source and the output image.
+	return (int64(src.Width)*int64(src.Height) + output*2) * bytesPerPixel
+}
+
+// targetSize returns the size of the icon image inside the padding.
+func targetSize(f Flags) float64 {
+	return float64(f.Size) - float64(f.Size)*(float64(f.Padding)/100)*2
 }
 
 func resize(f Flags, img scan.DecodedImage, rect image.Rectangle) scan.DecodedImage {
@@ -79,9 +185,8 @@ func resize(f Flags, img scan.DecodedImage, rect image.Rectangle) scan.DecodedIm
 	if imgSize < rect.Dy() {
 		imgSize = rect.Dy()
 	}
-	targetSize := float64(f.Size) - float64(f.Size)*(float64(f.Padding)/100)*2
-	ratio := targetSize / float64(imgSize)
-	slog.Debug("Resize ratio", slog.String("path", img.Path), slog.Float64("ratio", ratio))
+	ratio := targetSize(f) / float64(imgSize)
+	f.logger().Debug("Resize ratio", slog.String("path", img.Path), slog.Float64("ratio", ratio))
 
 	width := int(math.RoundToEven(float64(rect.Dx()) * ratio))
 	height := int(math.RoundToEven(float64(rect.Dy()) * ratio))
@@ -92,7 +197,7 @@ func resize(f Flags, img scan.DecodedImage, rect image.Rectangle) scan.DecodedIm
 		rect,
 		draw.Src,
 		nil)
-	slog.Debug("Resized image", slog.String("path", img.Path), slog.String("dimension", fmt.Sprintf("%dx%d", width, height)))
+	f.logger().Debug("Resized image", slog.String("path", img.Path), slog.String("dimension", fmt.Sprintf("%dx%d", width, height)))
 	return scan.DecodedImage{
 		Image:  resized,
 		Path:   img.Path,
@@ -101,18 +206,142 @@ func resize(f Flags, img scan.DecodedImage, rect image.Rectangle) scan.DecodedIm
 	}
 }
 
+// renderVector renders the vector source directly at the target size, so it stays sharp at any size.
+// The trimming is computed on a render at twice the target size, then refined on a render of the trimmed area.
+// The trimmed area is returned in the units of the vector, rounded.
+func renderVector(f Flags, img scan.DecodedImage) (color.Color, image.Rectangle, scan.DecodedImage) {
+	target := max(targetSize(f), 1)
+	area := img.Vector.Bounds()
+
+	hires := renderVectorArea(img, area, target*vectorTrimScale)
+	bgColor := calculateColor(f.logger(), hires, f.Background, BackgroundDefaultColor)
+	trim := calculateTrimColors(f, hires)
+	if len(trim) > 0 {
+		area = trimVectorArea(hires, area, trim)
+		// Refine the trimmed area, as it can be much smaller than the whole image.
+		hires = renderVectorArea(img, area, target*vectorTrimScale)
+		area = trimVectorArea(hires, area, trim)
+	}
+	if fgColor := calculateForegroundColor(f.logger(), f.Foreground, bgColor); fgColor != nil {
+		img = recolorVector(f.logger(), img, fgColor, f.Tint)
+	}
+
+	width, height := 0, 0
+	if area.W > 0 && area.H > 0 {
+		ratio := target / max(area.W, area.H)
+		width = int(math.RoundToEven(area.W * ratio))
+		height = int(math.RoundToEven(area.H * ratio))
+	}
+	rendered := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Vector.Render(rendered, area)
+	f.logger().Debug("Rendered vector image", slog.String("path", img.Path), slog.String("dimension", fmt.Sprintf("%dx%d", width, height)))
+	rect := image.Rect(
+		int(math.Round(area.X)), int(math.Round(area.Y)),
+		int(math.Round(area.X+area.W)), int(math.Round(area.Y+area.H)))
+	return bgColor, rect, scan.DecodedImage{
+		Image:  rendered,
+		Path:   img.Path,
+		Width:  width,
+		Height: height,
+	}
+}
+
+// recolorVector recolors the vector source, or fallbacks to recolor the rendered image if not supported.
+func recolorVector(log *slog.Logger, img scan.DecodedImage, c color.Color, tint bool) scan.DecodedImage {
+	if recolorer, ok := img.Vector.(scan.Recolorer); ok {
+		vector, err := recolorer.Recolor(c, tint)
+		if err == nil {
+			img.Vector = vector
+			return img
+		}
+		log.Warn("Error recoloring vector, fallback to recolor rendered image", slog.String("path", img.Path), slog.Any("err", err))
+	}
+	img.Vector = recoloredVector{Vector: img.Vector, c: c, tint: tint}
+	return img
+}
+
+// recoloredVector recolors the rendered image of the vector.
+type recoloredVector struct {
+	scan.Vector
+	c    color.Color
+	tint bool
+}
+
+func (v recoloredVector) Render(dst *image.RGBA, r scan.Rect) {
+	v.Vector.Render(dst, r)
+	utils.Recolor(dst, v.c, v.tint)
+}
+
+// vectorTrimScale is the resolution, relative to the target size, of the render used for trimming vector image.
+const vectorTrimScale = 2
+
+// maxVectorTrimSize is the maximum dimension of the render used for trimming vector image.
+const maxVectorTrimSize = 4096
+
+// renderVectorArea renders the area of the vector image so that its longest side is the size.
+func renderVectorArea(img scan.DecodedImage, area scan.Rect, size float64) scan.DecodedImage {
+	if area.W <= 0 || area.H <= 0 {
+		return scan.DecodedImage{Image: image.NewRGBA(image.Rectangle{}), Path: img.Path}
+	}
+	ratio := min(size, maxVectorTrimSize) / max(area.W, area.H)
+	width := max(int(math.Ceil(area.W*ratio)), 1)
+	height := max(int(math.Ceil(area.H*ratio)), 1)
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Vector.Render(rgba, area)
+	return scan.DecodedImage{
+		Image:  rgba,
+		Path:   img.Path,
+		Width:  width,
+		Height: height,
+	}
+}
+
+// trimVectorArea returns the trimmed area, in source units, of the rendered area.
+// The result is expanded by one rendered pixel to not cut the anti-aliased edges.
+func trimVectorArea(rendered scan.DecodedImage, area scan.Rect, trim []color.Color) scan.Rect {
+	if rendered.Width == 0 || rendered.Height == 0 {
+		return area
+	}
+	rect := calculateTrimRect(rendered, trim)
+	// The max point of the trimmed rect is the last non-trimmed pixel, so it is expanded by one more pixel.
+	rect = image.Rectangle{Min: rect.Min.Sub(image.Pt(1, 1)), Max: rect.Max.Add(image.Pt(2, 2))}.Intersect(rendered.Bounds())
+	if rect.Empty() {
+		return area
+	}
+	sx := area.W / float64(rendered.Width)
+	sy := area.H / float64(rendered.Height)
+	return scan.Rect{
+		X: area.X + float64(rect.Min.X)*sx,
+		Y: area.Y + float64(rect.Min.Y)*sy,
+		W: float64(rect.Dx()) * sx,
+		H: float64(rect.Dy()) * sy,
+	}
+}
+
 func calculateTargetRect(f Flags, img scan.DecodedImage) (color.Color, image.Rectangle) {
+	bgColor := calculateColor(f.logger(), img, f.Background, BackgroundDefaultColor)
+	trim := calculateTrimColors(f, img)
+	if len(trim) == 0 {
+		return bgColor, img.Bounds()
+	}
+	return bgColor, calculateTrimRect(img, trim)
+}
+
+// calculateTrimColors returns the list of colors to trim from the image.
+func calculateTrimColors(f Flags, img scan.DecodedImage) []color.Color {
 	if f.Trim == "" {
-		return calculateColor(img, f.Background, BackgroundDefaultColor), img.Bounds()
+		return nil
 	}
 	colors := strings.Split(f.Trim, ",")
 	trim := make([]color.Color, 0, len(colors))
 	for _, s := range colors {
-		trim = append(trim, calculateColor(img, strings.TrimSpace(s), TransparentColor))
+		trim = append(trim, calculateColor(f.logger(), img, strings.TrimSpace(s), TransparentColor))
 	}
-	trim = utils.Uniq(trim)
+	return utils.Uniq(trim)
+}
 
-	// Trim colors by finding a new bound.
+// calculateTrimRect trims the colors by finding a new bound.
+func calculateTrimRect(img scan.DecodedImage, trim []color.Color) image.Rectangle {
 	minPt := img.Bounds().Min
 	maxPt := img.Bounds().Max
 
@@ -158,7 +387,7 @@ func calculateTargetRect(f Flags, img scan.DecodedImage) (color.Color, image.Rec
 			break MAXY
 		}
 	}
-	return calculateColor(img, f.Background, BackgroundDefaultColor), image.Rectangle{Min: minPt, Max: maxPt}
+	return image.Rectangle{Min: minPt, Max: maxPt}
 }
 
 func isContainAnyColors(colors []color.Color, img image.Image, x int, y int) bool {
@@ -172,7 +401,7 @@ func isContainAnyColors(colors []color.Color, img image.Image, x int, y int) boo
 	return false
 }
 
-func calculateColor(img scan.DecodedImage, bg string, fallback string) color.Color {
+func calculateColor(log *slog.Logger, img scan.DecodedImage, bg string, fallback string) color.Color {
 	if strings.HasPrefix(bg, AutoColor) {
 		c, ok := calculateAutoBackgroundColor(img)
 		if ok {
@@ -206,7 +435,7 @@ func calculateColor(img scan.DecodedImage, bg string, fallback string) color.Col
 		if ok {
 			return c
 		}
-		slog.Warn("Unsupported color, fallback to default hex",
+		log.Warn("Unsupported color, fallback to default hex",
 			slog.String("color", bg),
 			slog.String("default", fallback),
 		)
@@ -215,7 +444,7 @@ func calculateColor(img scan.DecodedImage, bg string, fallback string) color.Col
 
 	c, err := utils.ParseHexColor(bg)
 	if err != nil {
-		slog.Warn("Invalid hex color, fallback to default",
+		log.Warn("Invalid hex color, fallback to default",
 			slog.String("hex", bg),
 			slog.String("default", fallback))
 		if fallback == TransparentColor {
@@ -229,6 +458,26 @@ func calculateColor(img scan.DecodedImage, bg string, fallback string) color.Col
 	return c
 }
 
+// calculateForegroundColor returns the color used to recolor the source image, or nil to keep the original colors.
+// The auto color is the contrast color of the background.
+func calculateForegroundColor(log *slog.Logger, fg string, bg color.Color) color.Color {
+	if fg == "" {
+		return nil
+	}
+	if strings.HasPrefix(fg, AutoColor) {
+		if _, _, _, a := bg.RGBA(); a == 0 {
+			return color.Black
+		}
+		return contrastColor(bg)
+	}
+	c, ok := calculatePlaceholderColor(fg, TransparentColor)
+	if !ok {
+		log.Warn("Unsupported foreground color, keep the original colors", slog.String("color", fg))
+		return nil
+	}
+	return c
+}
+
 func calculateAutoBackgroundColor(img scan.DecodedImage) (color.Color, bool) {
 	c := img.At(0, 0)
 	diffCnt := 0
@@ -269,38 +518,91 @@ func calculateAutoBackgroundColor(img scan.DecodedImage) (color.Color, bool) {
 	return c, true
 }
 
-func writeOutImage(f OutputFlags, outName string, img image.Image) {
+func writeOutImage(f OutputFlags, outfile string, img image.Image) (int64, error) {
+	roundOutImage(f, outfile, img)
+	return WriteOutFile(f.logger(), outfile, FormatPNG, 0, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
+
+// FormatOutputColor formats the color as hex, or transparent if it is fully transparent.
+func FormatOutputColor(c color.Color) string {
+	if _, _, _, a := c.RGBA(); a == 0 {
+		return TransparentColor
+	}
+	return utils.FormatHexColor(c)
+}
+
+func roundOutImage(f OutputFlags, outfile string, img image.Image) {
 	if f.Round > 0 {
 		err := utils.RoundImage(img, float64(f.Round)/100)
 		if err != nil {
-			slog.Warn("Output format does not support rounding", slog.String("out", filepath.Join(f.Output, outName)))
+			f.logger().Warn("Output format does not support rounding", slog.String("out", outfile))
 		}
 	}
+}
 
-	outfile, ok := canWriteOutImage(f, outName)
-	if !ok {
-		return
-	}
-	o, err := os.Create(outfile)
-	if err == nil {
-		err = png.Encode(o, img)
+// ReserveOutFile resolves the output path of outName according to the OnExist policy.
+// The src is the source file path used by the newer policy, it can be empty when there is no source file.
+// The release must be called with the error of the write, it removes the file reserved by the rename policy on error.
+func ReserveOutFile(f OutputFlags, outName string, src string) (string, func(error), bool) {
+	if f.Output == StdoutOutput {
+		return StdoutOutput, releaseNothing, true
 	}
+	outfile := filepath.Join(f.Output, outName)
+	info, err := os.Stat(outfile)
 	if err != nil {
-		slog.Error("Error writing image", slog.String("out", outfile), slog.Any("err", err))
-		return
+		return outfile, releaseNothing, true
+	}
+
+	switch f.OnExist {
+	case OnExistOverwrite:
+		return outfile, releaseNothing, true
+	case OnExistRename:
+		renamed, reserved := renameOutFile(outfile)
+		if !reserved {
+			return renamed, releaseNothing, true
+		}
+		return renamed, func(err error) {
+			if err != nil {
+				_ = os.Remove(renamed)
+			}
+		}, true
+	case OnExistNewer:
+		if src != "" {
+			srcInfo, err := os.Stat(src)
+			if err == nil && srcInfo.ModTime().After(info.ModTime()) {
+				return outfile, releaseNothing, true
+			}
+		}
+		f.logger().Info("File up to date", slog.Any("path", outfile))
+		return outfile, releaseNothing, false
 	}
+	f.logger().Warn("File existed",
+		slog.Any("path", outfile),
+		slog.String("on-exist", f.OnExist),
+	)
+	return outfile, releaseNothing, false
 }
 
-func canWriteOutImage(f OutputFlags, outName string) (string, bool) {
-	outfile := filepath.Join(f.Output, outName)
-	if _, err := os.Stat(outfile); err == nil {
-		if !f.Overwrite {
-			slog.Warn("File existed",
-				slog.Any("path", outfile),
-				slog.Bool("override", f.Overwrite),
-			)
-			return outfile, false
+func releaseNothing(error) {}
+
+// renameOutFile returns the first non-existing path in the form of name-N.ext.
+// The path is reserved by creating an empty file, so concurrent jobs cannot pick the same name,
+// the file is then replaced by the atomic write. It returns false if the path could not be reserved.
+func renameOutFile(outfile string) (string, bool) {
+	ext := filepath.Ext(outfile)
+	name := strings.TrimSuffix(outfile, ext)
+	for i := 1; ; i++ {
+		renamed := fmt.Sprintf("%s-%d%s", name, i, ext)
+		file, err := os.OpenFile(renamed, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_ = file.Close()
+			return renamed, true
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			// Let the write report the error.
+			return renamed, false
 		}
 	}
-	return outfile, true
 }
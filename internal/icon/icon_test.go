@@ -0,0 +1,148 @@
+package icon
+
+import (
+	"context"
+	"errors"
+	"github.com/mawngo/piconic/internal/scan"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCanWriteOutImage(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.png")
+	existing := filepath.Join(dir, "out.png")
+	for _, path := range []string{src, existing} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		onExist string
+		outName string
+		srcTime time.Time
+		exp     string
+		ok      bool
+	}{
+		{name: "missing", onExist: OnExistSkip, outName: "new.png", exp: "new.png", ok: true},
+		{name: "skip", onExist: OnExistSkip, outName: "out.png", exp: "out.png"},
+		{name: "overwrite", onExist: OnExistOverwrite, outName: "out.png", exp: "out.png", ok: true},
+		{name: "rename", onExist: OnExistRename, outName: "out.png", exp: "out-1.png", ok: true},
+		{name: "rename again", onExist: OnExistRename, outName: "out.png", exp: "out-2.png", ok: true},
+		{name: "newer source", onExist: OnExistNewer, outName: "out.png", srcTime: future, exp: "out.png", ok: true},
+		{name: "older source", onExist: OnExistNewer, outName: "out.png", srcTime: past, exp: "out.png"},
+	}
+
+	for _, test := range tests {
+		if !test.srcTime.IsZero() {
+			if err := os.Chtimes(src, test.srcTime, test.srcTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f := OutputFlags{Output: dir, OnExist: test.onExist}
+		outfile, _, ok := ReserveOutFile(f, test.outName, src)
+		if outfile != filepath.Join(dir, test.exp) || ok != test.ok {
+			t.Errorf("%s: expected %s %v, got %s %v", test.name, test.exp, test.ok, outfile, ok)
+		}
+	}
+}
+
+func TestRenameOutFileConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	outfile := filepath.Join(dir, "out.png")
+	if err := os.WriteFile(outfile, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 16
+	names := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names[i], _ = renameOutFile(outfile)
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("name %s picked twice", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestRenameOutFileReleased(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "out.webp"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := OutputFlags{Output: dir, OnExist: OnExistRename}
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	for range 2 {
+		outfile, release, ok := ReserveOutFile(f, "out.webp", "")
+		if !ok || outfile != filepath.Join(dir, "out-1.webp") {
+			t.Fatalf("expected the reserved out-1.webp, got %s %v", outfile, ok)
+		}
+		// The write fails, as webp cannot be encoded.
+		_, err := WriteOutFile(f.logger(), outfile, "webp", 0, func(w io.Writer) error {
+			return EncodeImage(w, img, "webp", 0)
+		})
+		if err == nil {
+			t.Fatalf("expected the write to fail")
+		}
+		release(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the reserved files to be removed, got %d files", len(entries))
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	tests := []struct {
+		size uint
+		src  scan.Source
+		exp  int64
+	}{
+		{size: 100, src: scan.Source{Width: 50, Height: 40}, exp: (50*40 + 100*100*2) * bytesPerPixel},
+		{size: 100, src: scan.Source{Width: 24, Height: 24, Vector: true}, exp: (200*200 + 100*100*2) * bytesPerPixel},
+		{size: 4000, src: scan.Source{Width: 24, Height: 24, Vector: true}, exp: (4096*4096 + 4000*4000*2) * bytesPerPixel},
+	}
+
+	for _, test := range tests {
+		f := Flags{Size: test.size}
+		if got := f.EstimateMemory(test.src); got != test.exp {
+			t.Errorf("%d %+v: expected %d, got %d", test.size, test.src, test.exp, got)
+		}
+	}
+}
+
+func TestRenderIconCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img := scan.DecodedImage{Image: image.NewRGBA(image.Rect(0, 0, 64, 64)), Width: 64, Height: 64}
+	f := Flags{Size: 32, OutputFlags: OutputFlags{Background: TransparentColor, Trim: TransparentColor}}
+	if _, err := RenderIcon(ctx, f, img); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+	if _, err := RenderIcon(context.Background(), f, img); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package icon
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/mawngo/piconic/internal/utils"
+	matcolornames "golang.org/x/exp/shiny/materialdesign/colornames"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// Styles of the identicon.
+const (
+	IdenticonStyleGrid    = "grid"
+	IdenticonStyleRing    = "ring"
+	IdenticonStyleBauhaus = "bauhaus"
+)
+
+var IdenticonStyles = []string{IdenticonStyleGrid, IdenticonStyleRing, IdenticonStyleBauhaus}
+
+type IdenticonFlags struct {
+	OutputFlags
+	Size       uint
+	Style      string
+	Foreground string
+}
+
+// EstimateMemory returns the approximate bytes needed to generate the identicon.
+func (f IdenticonFlags) EstimateMemory() int64 {
+	return int64(f.Size) * int64(f.Size) * bytesPerPixel
+}
+
+// WriteIdenticon generates the identicon from the hash of the input.
+// The same input always generates the same identicon.
+func WriteIdenticon(f IdenticonFlags, input string) (out Output, err error) {
+	log := f.logger()
+	log.Info("Processing",
+		slog.String("input", input),
+		slog.String("style", f.Style),
+		slog.String("bg", f.Background),
+		slog.Any("size", f.Size),
+	)
+
+	outName := fmt.Sprintf("%s.%s%dpc%d.png", filenameNormalizer.Replace(strings.TrimSpace(input)), f.Style, f.Size, f.Padding)
+	outfile, release, ok := ReserveOutFile(f.OutputFlags, outName, "")
+	if !ok {
+		return Output{Path: outfile, Skipped: true}, nil
+	}
+	defer func() { release(err) }()
+
+	hash := sha256.Sum256([]byte(input))
+	palette := identiconPalette(hash)
+	bgColor := palette[0]
+	if !strings.HasPrefix(f.Background, AutoColor) {
+		bgColor = calculatePlaceholderBackgroundColor(log, f.Background)
+	}
+	if f.Foreground != "" && !strings.HasPrefix(f.Foreground, AutoColor) {
+		if c, ok := calculatePlaceholderColor(f.Foreground, TransparentColor); ok {
+			palette[1] = c
+		} else {
+			log.Warn("Unsupported foreground color, fallback to auto", slog.String("color", f.Foreground))
+		}
+	}
+
+	img := renderIdenticon(f, hash, palette, bgColor)
+	out = Output{Path: outfile, Width: int(f.Size), Height: int(f.Size), Background: FormatOutputColor(bgColor)}
+	out.Size, err = writeOutImage(f.OutputFlags, outfile, img)
+	return out, err
+}
+
+// renderIdenticon draws the pattern of the style over the background.
+func renderIdenticon(f IdenticonFlags, hash [32]byte, palette [4]color.Color, bgColor color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, int(f.Size), int(f.Size)))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bgColor}, image.Point{}, draw.Src)
+
+	// The pattern is drawn in the padded area.
+	size := float64(f.Size) * (1 - float64(f.Padding)*2/100)
+	offset := (float64(f.Size) - size) / 2
+	area := image.Rect(0, 0, int(math.Round(size)), int(math.Round(size))).Add(image.Pt(
+		int(math.Round(offset+float64(f.Size)*float64(f.PadX)/100)),
+		int(math.Round(offset+float64(f.Size)*float64(f.PadY)/100)),
+	))
+	canvas, ok := img.SubImage(area).(*image.RGBA)
+	if ok && !canvas.Bounds().Empty() {
+		switch f.Style {
+		case IdenticonStyleRing:
+			drawRingIdenticon(canvas, hash, palette)
+		case IdenticonStyleBauhaus:
+			drawBauhausIdenticon(canvas, hash, palette)
+		default:
+			drawGridIdenticon(canvas, hash, palette)
+		}
+	}
+	return img
+}
+
+// identiconPalette returns the background and 3 foreground colors derived from the hash.
+func identiconPalette(hash [32]byte) [4]color.Color {
+	hue := float64(uint16(hash[28])<<8|uint16(hash[29])) / 65536 * 360
+	saturation := 0.55 + float64(hash[30])/255*0.2
+	lightness := 0.45 + float64(hash[31])/255*0.1
+	fg := utils.HSLColor(hue, saturation, lightness)
+	return [4]color.Color{
+		utils.HSLColor(hue, saturation, 0.94),
+		fg,
+		matcolornames.Map[avatarColors[int(hash[26])%len(avatarColors)]],
+		matcolornames.Map[avatarColors[int(hash[27])%len(avatarColors)]],
+	}
+}
+
+// drawGridIdenticon draws the GitHub style 5x5 symmetric pixel grid.
+func drawGridIdenticon(dst *image.RGBA, hash [32]byte, palette [4]color.Color) {
+	const cells = 5
+	b := dst.Bounds()
+	cell := float64(b.Dx()) / cells
+	for col := range (cells + 1) / 2 {
+		for row := range cells {
+			if hash[col*cells+row]&1 == 1 {
+				continue
+			}
+			for _, c := range []int{col, cells - 1 - col} {
+				x, y := float64(c)*cell, float64(row)*cell
+				fillPolygon(dst, palette[1], [][2]float64{{x, y}, {x + cell, y}, {x + cell, y + cell}, {x, y + cell}})
+			}
+		}
+	}
+}
+
+// drawRingIdenticon draws concentric rings split into segments, symmetric by the vertical axis.
+func drawRingIdenticon(dst *image.RGBA, hash [32]byte, palette [4]color.Color) {
+	const (
+		rings    = 3
+		segments = 8
+	)
+	b := dst.Bounds()
+	radius := float64(b.Dx()) / 2
+	cx, cy := radius, radius
+	width := radius / (rings + 1)
+	if hash[0]&1 == 0 {
+		fillPolygon(dst, palette[2], arcPolygon(cx, cy, 0, width*0.9, 0, 2*math.Pi))
+	}
+	for ring := range rings {
+		inner := width * float64(ring+1)
+		outer := inner + width*0.9
+		c := palette[1]
+		if ring%2 == 1 {
+			c = palette[3]
+		}
+		step := 2 * math.Pi / segments
+		for seg := range segments / 2 {
+			if hash[1+ring*segments/2+seg]&1 == 1 {
+				continue
+			}
+			// Start from the top, mirror to the left side.
+			start := -math.Pi/2 + float64(seg)*step
+			fillPolygon(dst, c, arcPolygon(cx, cy, inner, outer, start+0.02, start+step-0.02))
+			mirror := math.Pi - start - step
+			fillPolygon(dst, c, arcPolygon(cx, cy, inner, outer, mirror+0.02, mirror+step-0.02))
+		}
+	}
+}
+
+// drawBauhausIdenticon draws the overlapping rectangle, circle and line with colors from the hash.
+func drawBauhausIdenticon(dst *image.RGBA, hash [32]byte, palette [4]color.Color) {
+	b := dst.Bounds()
+	size := float64(b.Dx())
+	unit := func(i int) float64 {
+		return float64(hash[i]) / 255
+	}
+
+	// Rectangle.
+	w, h := size*(0.5+unit(0)*0.4), size*(0.2+unit(1)*0.3)
+	fillPolygon(dst, palette[1], rotatedRect(size/2+(unit(2)-0.5)*size*0.3, size/2+(unit(3)-0.5)*size*0.3, w, h, unit(4)*math.Pi))
+	// Circle.
+	r := size * (0.15 + unit(5)*0.15)
+	fillPolygon(dst, palette[2], arcPolygon(size/2+(unit(6)-0.5)*size*0.5, size/2+(unit(7)-0.5)*size*0.5, 0, r, 0, 2*math.Pi))
+	// Line.
+	fillPolygon(dst, palette[3], rotatedRect(size/2+(unit(8)-0.5)*size*0.4, size/2+(unit(9)-0.5)*size*0.4, size*1.5, size*0.06, unit(10)*math.Pi))
+}
+
+func rotatedRect(cx, cy, w, h, angle float64) [][2]float64 {
+	sin, cos := math.Sincos(angle)
+	pts := make([][2]float64, 0, 4)
+	for _, p := range [][2]float64{{-w / 2, -h / 2}, {w / 2, -h / 2}, {w / 2, h / 2}, {-w / 2, h / 2}} {
+		pts = append(pts, [2]float64{cx + p[0]*cos - p[1]*sin, cy + p[0]*sin + p[1]*cos})
+	}
+	return pts
+}
+
+// arcPolygon returns the polygon of the ring segment from the start to the end angle.
+// The inner radius of 0 gives a pie slice.
+func arcPolygon(cx, cy, inner, outer, start, end float64) [][2]float64 {
+	steps := max(int(math.Ceil((end-start)/(math.Pi/64))), 1)
+	pts := make([][2]float64, 0, steps*2+2)
+	for i := 0; i <= steps; i++ {
+		a := start + (end-start)*float64(i)/float64(steps)
+		pts = append(pts, [2]float64{cx + outer*math.Cos(a), cy + outer*math.Sin(a)})
+	}
+	if inner <= 0 {
+		return append(pts, [2]float64{cx, cy})
+	}
+	for i := steps; i >= 0; i-- {
+		a := start + (end-start)*float64(i)/float64(steps)
+		pts = append(pts, [2]float64{cx + inner*math.Cos(a), cy + inner*math.Sin(a)})
+	}
+	return pts
+}
+
+// fillPolygon fills the anti-aliased polygon, the points are relative to the dst bounds.
+func fillPolygon(dst *image.RGBA, c color.Color, pts [][2]float64) {
+	fillPolygons(dst, c, [][][2]float64{pts})
+}
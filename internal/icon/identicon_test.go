@@ -0,0 +1,64 @@
+package icon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"testing"
+)
+
+func TestWriteIdenticonDeterministic(t *testing.T) {
+	for _, style := range IdenticonStyles {
+		var outputs [2][]byte
+		for i := range outputs {
+			f := IdenticonFlags{
+				OutputFlags: OutputFlags{Output: t.TempDir(), OnExist: OnExistSkip, Background: AutoColor},
+				Size:        64,
+				Style:       style,
+				Foreground:  AutoColor,
+			}
+			out, err := WriteIdenticon(f, "mawngo/piconic")
+			if err != nil {
+				t.Fatalf("%s: %v", style, err)
+			}
+			if outputs[i], err = os.ReadFile(out.Path); err != nil {
+				t.Fatalf("%s: %v", style, err)
+			}
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%s: expected the same input to generate identical images", style)
+		}
+	}
+}
+
+func TestIdenticonSymmetric(t *testing.T) {
+	tests := []struct {
+		style string
+		// Maximum difference of the mirrored channels, as anti-aliased arcs are not pixel exact.
+		tolerance int
+	}{
+		{style: IdenticonStyleGrid},
+		{style: IdenticonStyleRing, tolerance: 2},
+	}
+
+	for _, test := range tests {
+		for _, input := range []string{"a", "mawngo/piconic", "identicon"} {
+			hash := sha256.Sum256([]byte(input))
+			palette := identiconPalette(hash)
+			f := IdenticonFlags{Size: 100, Style: test.style}
+			img := renderIdenticon(f, hash, palette, palette[0])
+			w := img.Bounds().Dx()
+			for y := range img.Bounds().Dy() {
+				for x := range w / 2 {
+					left, right := img.RGBAAt(x, y), img.RGBAAt(w-1-x, y)
+					for i, l := range []uint8{left.R, left.G, left.B, left.A} {
+						r := []uint8{right.R, right.G, right.B, right.A}[i]
+						if diff := int(l) - int(r); diff > test.tolerance || -diff > test.tolerance {
+							t.Fatalf("%s %q: pixel (%d,%d) %v is not mirrored by %v", test.style, input, x, y, left, right)
+						}
+					}
+				}
+			}
+		}
+	}
+}
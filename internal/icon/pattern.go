@@ -0,0 +1,210 @@
+package icon
+
+import (
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// Styles of the placeholder background.
+const (
+	PlaceholderStyleFlat         = "flat"
+	PlaceholderStyleWireframe    = "wireframe"
+	PlaceholderStyleCheckerboard = "checkerboard"
+	PlaceholderStyleStripes      = "stripes"
+	PlaceholderStyleGrid         = "grid"
+	PlaceholderStyleArrows       = "arrows"
+)
+
+var PlaceholderStyles = []string{
+	PlaceholderStyleFlat,
+	PlaceholderStyleWireframe,
+	PlaceholderStyleCheckerboard,
+	PlaceholderStyleStripes,
+	PlaceholderStyleGrid,
+	PlaceholderStyleArrows,
+}
+
+// defaultPatternSize is the cell size of the pattern in pixel, when not specified.
+const defaultPatternSize = 50
+
+// Opacity of the pattern, over the background.
+const (
+	patternFillAlpha = 0.12
+	patternLineAlpha = 0.35
+)
+
+// patternLayer is the polygons of the pattern filled with the same color.
+type patternLayer struct {
+	c     color.Color
+	polys [][][2]float64
+}
+
+// patternLabel is a text of the pattern, with its baseline starting at (x, y).
+type patternLabel struct {
+	text     string
+	x        float64
+	y        float64
+	fontsize float64
+	c        color.Color
+}
+
+// drawPattern draws the pattern of the style over the background.
+func drawPattern(f PlaceholderFlags, dst *image.RGBA, bg color.Color) {
+	layers, labels := calculatePattern(f, bg)
+	for _, layer := range layers {
+		fillPolygons(dst, layer.c, layer.polys)
+	}
+	for _, label := range labels {
+		f.font().face(label.fontsize).draw(dst, image.NewUniform(label.c), fixed.P(int(label.x), int(label.y)), label.text, 0)
+	}
+}
+
+// calculatePattern returns the shapes and the labels of the pattern of the style.
+func calculatePattern(f PlaceholderFlags, bg color.Color) ([]patternLayer, []patternLabel) {
+	size := f.PatternSize
+	if size <= 0 {
+		size = defaultPatternSize
+	}
+	w, h := float64(f.W), float64(f.H)
+	// Lines are thicker on bigger images, so they stay visible when scaled down.
+	lw := max(1, math.Round(min(w, h)/200))
+
+	switch f.Style {
+	case PlaceholderStyleWireframe:
+		polys := [][][2]float64{
+			linePolygon(0, 0, w, h, lw),
+			linePolygon(w, 0, 0, h, lw),
+		}
+		polys = append(polys, dashedRectPolygons(lw/2, lw/2, w-lw/2, h-lw/2, lw, max(4, min(w, h)/40))...)
+		return []patternLayer{{c: patternColor(bg, patternLineAlpha), polys: polys}}, nil
+	case PlaceholderStyleCheckerboard:
+		var polys [][][2]float64
+		for y := 0; y < f.H; y += size {
+			for x := (y / size % 2) * size; x < f.W; x += size * 2 {
+				polys = append(polys, rectPolygon(float64(x), float64(y), float64(x+size), float64(y+size)))
+			}
+		}
+		return []patternLayer{{c: patternColor(bg, patternFillAlpha), polys: polys}}, nil
+	case PlaceholderStyleStripes:
+		var polys [][][2]float64
+		half := float64(size) / 2
+		// Diagonal stripes, going down to the left at 45 degree.
+		for x := 0.0; x < w+h; x += float64(size) {
+			polys = append(polys, [][2]float64{{x, 0}, {x + half, 0}, {x + half - h, h}, {x - h, h}})
+		}
+		return []patternLayer{{c: patternColor(bg, patternFillAlpha), polys: polys}}, nil
+	case PlaceholderStyleGrid:
+		return calculateGridPattern(f, bg, size, lw)
+	case PlaceholderStyleArrows:
+		return calculateArrowsPattern(f, bg, lw), nil
+	}
+	return nil, nil
+}
+
+// calculateGridPattern returns the grid lines every size pixel, with rulers labeled with the pixel position.
+func calculateGridPattern(f PlaceholderFlags, bg color.Color, size int, lw float64) ([]patternLayer, []patternLabel) {
+	w, h := float64(f.W), float64(f.H)
+	var polys [][][2]float64
+	for x := size; x < f.W; x += size {
+		polys = append(polys, rectPolygon(float64(x)-lw/2, 0, float64(x)+lw/2, h))
+	}
+	for y := size; y < f.H; y += size {
+		polys = append(polys, rectPolygon(0, float64(y)-lw/2, w, float64(y)+lw/2))
+	}
+	layers := []patternLayer{{c: patternColor(bg, patternLineAlpha), polys: polys}}
+
+	// Label the lines on the top and the left edge, skipping lines so the labels do not overlap.
+	fontsize := math.Round(min(max(float64(size)/4, 8), 14))
+	face := f.font().face(fontsize)
+	every := 1
+	if widest := face.measure(strconv.Itoa(max(f.W, f.H))); widest+fontsize > float64(size) {
+		every = int(math.Ceil((widest + fontsize) / float64(size)))
+	}
+	c := patternColor(bg, patternLineAlpha*2)
+	gap := lw + fontsize/4
+	var labels []patternLabel
+	for x := size * every; x < f.W; x += size * every {
+		labels = append(labels, patternLabel{text: strconv.Itoa(x), x: float64(x) + gap, y: gap + face.height*0.8, fontsize: fontsize, c: c})
+	}
+	for y := size * every; y < f.H; y += size * every {
+		labels = append(labels, patternLabel{text: strconv.Itoa(y), x: gap, y: float64(y) - gap, fontsize: fontsize, c: c})
+	}
+	return layers, labels
+}
+
+// calculateArrowsPattern returns the double-headed arrows along the width and the height.
+func calculateArrowsPattern(f PlaceholderFlags, bg color.Color, lw float64) []patternLayer {
+	w, h := float64(f.W), float64(f.H)
+	head := max(6, math.Round(min(w, h)/25))
+	inset := max(head, math.Round(min(w, h)/12))
+	polys := [][][2]float64{
+		// Width arrow.
+		linePolygon(head, inset, w-head, inset, lw),
+		{{0, inset}, {head, inset - head/2}, {head, inset + head/2}},
+		{{w, inset}, {w - head, inset - head/2}, {w - head, inset + head/2}},
+		// Height arrow.
+		linePolygon(inset, head, inset, h-head, lw),
+		{{inset, 0}, {inset - head/2, head}, {inset + head/2, head}},
+		{{inset, h}, {inset - head/2, h - head}, {inset + head/2, h - head}},
+	}
+	return []patternLayer{{c: patternColor(bg, patternLineAlpha*2), polys: polys}}
+}
+
+// patternColor returns the contrast color of the background with the opacity.
+func patternColor(bg color.Color, alpha float64) color.Color {
+	c := color.Color(color.Black)
+	if bg != color.Transparent {
+		c = contrastColor(bg)
+	}
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	nc.A = uint8(math.Round(alpha * 255))
+	return nc
+}
+
+// rectPolygon returns the polygon of the rectangle from (x0, y0) to (x1, y1).
+func rectPolygon(x0, y0, x1, y1 float64) [][2]float64 {
+	return [][2]float64{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+// linePolygon returns the polygon of the line from (x0, y0) to (x1, y1) with the width.
+func linePolygon(x0, y0, x1, y1, width float64) [][2]float64 {
+	length := math.Hypot(x1-x0, y1-y0)
+	return rotatedRect((x0+x1)/2, (y0+y1)/2, length, width, math.Atan2(y1-y0, x1-x0))
+}
+
+// dashedRectPolygons returns the dashes along the border of the rectangle from (x0, y0) to (x1, y1).
+func dashedRectPolygons(x0, y0, x1, y1, width, dash float64) [][][2]float64 {
+	var polys [][][2]float64
+	for x := x0; x < x1; x += dash * 2 {
+		end := min(x+dash, x1)
+		polys = append(polys, linePolygon(x, y0, end, y0, width), linePolygon(x, y1, end, y1, width))
+	}
+	for y := y0; y < y1; y += dash * 2 {
+		end := min(y+dash, y1)
+		polys = append(polys, linePolygon(x0, y, x0, end, width), linePolygon(x1, y, x1, end, width))
+	}
+	return polys
+}
+
+// fillPolygons fills the anti-aliased polygons in one pass, the points are relative to the dst bounds.
+func fillPolygons(dst *image.RGBA, c color.Color, polys [][][2]float64) {
+	b := dst.Bounds()
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	z.DrawOp = draw.Over
+	for _, pts := range polys {
+		if len(pts) < 3 {
+			continue
+		}
+		z.MoveTo(float32(pts[0][0]), float32(pts[0][1]))
+		for _, p := range pts[1:] {
+			z.LineTo(float32(p[0]), float32(p[1]))
+		}
+		z.ClosePath()
+	}
+	z.Draw(dst, b, image.NewUniform(c), image.Point{})
+}
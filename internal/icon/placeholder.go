@@ -1,30 +1,42 @@
 package icon
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/goki/freetype"
-	"github.com/goki/freetype/truetype"
 	"github.com/mawngo/piconic/internal/utils"
 	matcolornames "golang.org/x/exp/shiny/materialdesign/colornames"
 	"golang.org/x/image/colornames"
 	"golang.org/x/image/draw"
-	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"hash/fnv"
 	"image"
 	"image/color"
+	"io"
 	"log/slog"
 	"math"
-	"math/rand"
+	"math/rand/v2"
+	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-var tff *truetype.Font
-
 const noneText = "<none>"
 
+// Alignments of the placeholder text.
+const (
+	AlignStart  = "start"
+	AlignCenter = "center"
+	AlignEnd    = "end"
+)
+
+var Aligns = []string{AlignStart, AlignCenter, AlignEnd}
+
 var filenameNormalizer = strings.NewReplacer(
 	" ", "-",
+	"\n", "-",
+	`\n`, "-",
 	"?", "",
 	"\\", "",
 	":", "",
@@ -36,212 +48,570 @@
 	"\"", "",
 )
 
+// NormalizeFileName removes the characters not allowed in file names, and replaces the spaces and new lines with -.
+func NormalizeFileName(name string) string {
+	return filenameNormalizer.Replace(name)
+}
+
 var (
-	placeholderSizeRegex      = regexp.MustCompile(`^[1-9][0-9]*x[1-9][0-9]*$`)
 	placeholderTextColorRegex = regexp.MustCompile(`(<.+>)$`)
 )
 
-func InitFont(ttf []byte) {
-	var err error
-	if tff, err = freetype.ParseFont(ttf); err != nil {
-		panic(err)
-	}
+var ErrInvalidColor = errors.New("invalid color")
+
+type PlaceholderFlags struct {
+	OutputFlags
+	// W and H are the size of the output image.
+	W int
+	H int
+	// Density of the output image, the default text uses the size at 1x, 0 for 1x.
+	Density int
+	// TextColor is used when the text has no <color> suffix, empty for the contrast of the background.
+	TextColor string
+	// Seed of the auto colors, combined with the text and the dimension.
+	Seed string
+	// MinContrast is the minimum contrast ratio between the auto color and the other color, 0 to disable.
+	MinContrast float64
+	// MaxLines is the maximum number of lines the text is wrapped into, 0 for single line.
+	MaxLines int
+	// MinFontSize is the font size which the text is truncated with an ellipsis instead of shrinking further.
+	MinFontSize float64
+	// LineHeight is the distance between lines, relative to the font height, 0 for 1.
+	LineHeight float64
+	// Font of the text, nil for the default font.
+	Font *Font
+	// StrokeWidth is the width of the text outline in pixel, 0 to disable.
+	StrokeWidth int
+	// StrokeColor of the text outline, auto for the contrast of the text color.
+	StrokeColor string
+	// ShadowX and ShadowY are the offset of the text shadow in pixel, both 0 to disable.
+	ShadowX     int
+	ShadowY     int
+	ShadowColor string
+	// LetterSpacing is the extra space between characters, relative to the font size.
+	LetterSpacing float64
+	// AlignX and AlignY are the alignment of the text in the padded area, empty for center.
+	AlignX string
+	AlignY string
+	// Uppercase transforms the text to uppercase.
+	Uppercase bool
+	// Style of the background pattern, empty for flat.
+	Style string
+	// PatternSize is the cell size of the pattern in pixel, 0 for default.
+	PatternSize int
+	// Format of the output file, empty for png.
+	Format string
+	// Quality of the jpeg output, 0 for default.
+	Quality int
 }
 
-func ParsePlaceholderSize(size string) (w int, h int, valid bool) {
-	if !placeholderSizeRegex.MatchString(size) {
-		return 0, 0, false
+// DefaultPlaceholderFlags returns the default placeholder flags, shared by the commands, the server and the package.
+func DefaultPlaceholderFlags() PlaceholderFlags {
+	return PlaceholderFlags{
+		OutputFlags: OutputFlags{
+			Padding:    10,
+			Background: AutoColor + "," + BackgroundDefaultColor,
+		},
+		MaxLines:    3,
+		LineHeight:  1,
+		StrokeColor: AutoColor,
+		ShadowColor: "#00000066",
+		AlignX:      AlignCenter,
+		AlignY:      AlignCenter,
+		Style:       PlaceholderStyleFlat,
+		Format:      FormatPNG,
+		Quality:     DefaultJPEGQuality,
 	}
+}
 
-	wh := strings.Split(size, "x")
-	if len(wh) != 2 {
-		return 0, 0, false
-	}
-	w, err := strconv.Atoi(wh[0])
-	if err != nil {
-		panic(err)
-	}
-	h, err = strconv.Atoi(wh[1])
-	if err != nil {
-		panic(err)
+// WithDensity returns the flags for the size at the density, scaling the sizes in pixel.
+func (f PlaceholderFlags) WithDensity(size PlaceholderSize) PlaceholderFlags {
+	d := max(size.Density, 1)
+	f.W, f.H = size.W*d, size.H*d
+	f.Density = size.Density
+	f.MinFontSize *= float64(d)
+	f.StrokeWidth *= d
+	f.ShadowX *= d
+	f.ShadowY *= d
+	f.PatternSize *= d
+	return f
+}
+
+func (f PlaceholderFlags) font() *Font {
+	if f.Font == nil {
+		return defaultFont
 	}
-	return w, h, true
+	return f.Font
 }
 
-type PlaceholderFlags struct {
-	OutputFlags
-	W int
-	H int
+// EstimateMemory returns the approximate bytes needed to generate the placeholder.
+func (f PlaceholderFlags) EstimateMemory() int64 {
+	// The image and the text masks.
+	return int64(f.W) * int64(f.H) * (bytesPerPixel + 2)
+}
+
+// EncodePlaceholder renders the placeholder and encodes it in the format of the flags.
+// The text is empty for the size, or ends with a <color> suffix.
+// Rendering stops with the error of the context when it is done.
+func EncodePlaceholder(ctx context.Context, w io.Writer, f PlaceholderFlags, placeholder string) error {
+	placeholder, dimStr := placeholderText(f, placeholder)
+	text, bgColor, textColor := preparePlaceholder(f, placeholder, dimStr)
+	return encodePlaceholder(ctx, w, f, text, bgColor, textColor)
+}
+
+// RenderPlaceholder renders the placeholder image, the text is the same as EncodePlaceholder.
+// Rendering stops with the error of the context when it is done.
+func RenderPlaceholder(ctx context.Context, f PlaceholderFlags, placeholder string) (*image.RGBA, error) {
+	placeholder, dimStr := placeholderText(f, placeholder)
+	text, bgColor, textColor := preparePlaceholder(f, placeholder, dimStr)
+	return renderPlaceholder(ctx, f, text, bgColor, textColor)
+}
+
+// PlaceholderColors returns the background and the text colors of the placeholder, the text is the same as RenderPlaceholder.
+func PlaceholderColors(f PlaceholderFlags, placeholder string) (color.Color, color.Color) {
+	placeholder, dimStr := placeholderText(f, placeholder)
+	_, bgColor, textColor := preparePlaceholder(f, placeholder, dimStr)
+	return bgColor, textColor
 }
 
-func WritePlaceholder(f PlaceholderFlags, placeholder string) {
-	dimStr := fmt.Sprintf("%dx%d", f.W, f.H)
+// placeholderText returns the text to draw and the size at 1x density.
+func placeholderText(f PlaceholderFlags, placeholder string) (string, string) {
+	density := max(f.Density, 1)
+	dimStr := fmt.Sprintf("%dx%d", f.W/density, f.H/density)
 	if placeholder == "" {
 		placeholder = dimStr
 	}
 	if placeholder == noneText {
 		placeholder = ""
 	}
-	slog.Info("Processing",
-		slog.String("text", placeholder),
-		slog.String("dimension", dimStr),
-		slog.String("bg", f.Background),
-	)
+	return placeholder, dimStr
+}
 
-	outName := fmt.Sprintf("%spc%d.png", dimStr, f.Padding)
-	if placeholder != "" && placeholder != dimStr {
-		outName = filenameNormalizer.Replace(placeholder) + "." + outName
+// preparePlaceholder returns the text to draw, without the color suffix, and the colors of the placeholder.
+func preparePlaceholder(f PlaceholderFlags, placeholder string, dimStr string) (string, color.Color, color.Color) {
+	rng := newPlaceholderRand(f.Seed, placeholder, dimStr)
+	placeholder, textColorName := splitPlaceholderTextColor(placeholder, dimStr)
+	if textColorName == "" {
+		textColorName = f.TextColor
 	}
-	outfile, ok := canWriteOutImage(f.OutputFlags, outName)
-	if !ok {
-		return
+	bgColor, textColor := calculatePlaceholderColors(f, textColorName, rng)
+	if f.Uppercase {
+		placeholder = strings.ToUpper(placeholder)
+	}
+	if missing := f.font().missing(placeholder); missing != "" {
+		f.logger().Warn("Characters missing from the fonts are drawn as empty boxes, use a fallback font", slog.String("chars", missing))
 	}
+	return placeholder, bgColor, textColor
+}
 
-	bgColor := calculatePlaceholderBackgroundColor(f.Background)
-	placeholder, textColor := calculatePlaceholderTextColor(placeholder, bgColor, dimStr)
+func encodePlaceholder(ctx context.Context, w io.Writer, f PlaceholderFlags, text string, bgColor color.Color, textColor color.Color) error {
+	if f.Format == FormatSVG {
+		return writePlaceholderSVG(ctx, w, f, text, bgColor, textColor)
+	}
+	img, err := renderPlaceholder(ctx, f, text, bgColor, textColor)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return EncodeImage(w, img, f.Format, f.Quality)
+}
 
+func renderPlaceholder(ctx context.Context, f PlaceholderFlags, text string, bgColor color.Color, textColor color.Color) (*image.RGBA, error) {
 	img := image.NewRGBA(image.Rect(0, 0, f.W, f.H))
 	draw.Draw(img, img.Bounds(), &image.Uniform{C: bgColor}, image.Point{}, draw.Src)
+	drawPattern(f, img, bgColor)
 
-	if placeholder != "" {
-		fontsize, xOffset, yOffset, err := calculateFontSize(f, placeholder, img)
-		xcenter := (float64(f.W) / 2.0) - xOffset + (float64(f.W) * float64(f.PadX) / 100)
-		ycenter := (float64(f.H) / 2.0) - yOffset + (float64(f.H) * float64(f.PadY) / 100)
-		if err != nil {
-			slog.Error("Error calculating tff size", slog.String("dimension", dimStr), slog.Any("err", err))
-			return
+	if text != "" {
+		if err := drawText(ctx, f, img, text, textColor); err != nil {
+			return nil, err
 		}
+	}
+	if f.Round > 0 {
+		if err := utils.RoundImage(img, float64(f.Round)/100); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// PlaceholderFileName returns the output file name from the name, adding the density suffix and the format extension.
+func PlaceholderFileName(name string, density int, format string) string {
+	// Keep the output inside the output directory.
+	name = filepath.Base(name)
+	ext := filepath.Ext(name)
+	if ext == "" {
+		ext = FormatExt(format)
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if density > 1 {
+		name += fmt.Sprintf("@%dx", density)
+	}
+	return name + ext
+}
 
-		c := freetype.NewContext()
-		c.SetFont(tff)
-		c.SetSrc(&image.Uniform{C: color.Transparent})
-		c.SetDst(img)
-		c.SetClip(img.Bounds())
-		c.SetFontSize(fontsize)
-		c.SetSrc(image.NewUniform(&image.Uniform{C: textColor}))
-		_, err = c.DrawString(placeholder, freetype.Pt(int(xcenter), int(ycenter)))
-		if err != nil {
-			slog.Error("Error drawing text", slog.String("dimension", dimStr), slog.Any("err", err))
-			return
+// drawText draws the text block aligned in the padded area, using the biggest font size that fits it.
+func drawText(ctx context.Context, f PlaceholderFlags, img draw.Image, text string, textColor color.Color) error {
+	layout, lines, err := placeText(ctx, f, text)
+	if err != nil {
+		return err
+	}
+
+	// Draw the text into a mask, so the outline and the shadow can be made from it.
+	mask := image.NewAlpha(img.Bounds())
+	spacing := fixed.Int26_6(layout.spacing * 64)
+	for _, line := range lines {
+		layout.face.draw(mask, image.Opaque, fixed.P(int(line.x), int(line.y)), line.text, spacing)
+	}
+
+	outline := mask
+	if f.StrokeWidth > 0 {
+		outline = utils.DilateAlpha(mask, f.StrokeWidth)
+	}
+	if f.ShadowX != 0 || f.ShadowY != 0 {
+		shadow := image.Pt(f.ShadowX, f.ShadowY)
+		draw.DrawMask(img, img.Bounds().Add(shadow), image.NewUniform(calculateShadowColor(f)), image.Point{}, outline, img.Bounds().Min, draw.Over)
+	}
+	if f.StrokeWidth > 0 {
+		draw.DrawMask(img, img.Bounds(), image.NewUniform(calculateStrokeColor(f, textColor)), image.Point{}, outline, img.Bounds().Min, draw.Over)
+	}
+	draw.DrawMask(img, img.Bounds(), image.NewUniform(textColor), image.Point{}, mask, img.Bounds().Min, draw.Over)
+	return nil
+}
+
+// placedLine is a line of text positioned in the image.
+type placedLine struct {
+	text string
+	// x is the left of the line, anchorX is the x of its alignment point.
+	x       float64
+	anchorX float64
+	// y is the baseline of the line.
+	y float64
+}
+
+// placeText wraps the text and aligns its lines in the padded area, using the biggest font size that fits it.
+func placeText(ctx context.Context, f PlaceholderFlags, text string) (textLayout, []placedLine, error) {
+	layout, err := layoutText(ctx, f, text)
+	if err != nil {
+		return layout, nil, err
+	}
+
+	// Measure the bounds of the whole block, relative to the baseline of the first line.
+	top, bottom := math.Inf(1), math.Inf(-1)
+	for i, line := range layout.lines {
+		bound, _ := layout.face.bound(line)
+		baseline := float64(i) * layout.lineAdvance
+		top = min(top, baseline+float64(bound.Min.Y)/64)
+		bottom = max(bottom, baseline+float64(bound.Max.Y)/64)
+	}
+
+	marginX := (float64(f.W) - layout.maxW) / 2
+	marginY := (float64(f.H) - layout.maxH) / 2
+	offsetX := float64(f.W) * float64(f.PadX) / 100
+	offsetY := float64(f.H) * float64(f.PadY) / 100
+	var baseline float64
+	switch f.AlignY {
+	case AlignStart:
+		baseline = marginY - top + offsetY
+	case AlignEnd:
+		baseline = float64(f.H) - marginY - bottom + offsetY
+	default:
+		baseline = (float64(f.H) / 2.0) - (top+bottom)/2 + offsetY
+	}
+
+	lines := make([]placedLine, 0, len(layout.lines))
+	for i, text := range layout.lines {
+		line := placedLine{
+			text: text,
+			y:    baseline + float64(i)*layout.lineAdvance,
+		}
+		advance := layout.measure(text)
+		switch f.AlignX {
+		case AlignStart:
+			line.anchorX = marginX + offsetX
+			line.x = line.anchorX
+		case AlignEnd:
+			line.anchorX = float64(f.W) - marginX + offsetX
+			line.x = line.anchorX - advance
+		default:
+			line.anchorX = (float64(f.W) / 2.0) + offsetX
+			line.x = line.anchorX - advance/2
 		}
+		lines = append(lines, line)
 	}
-	writeOutImage(f.OutputFlags, outfile, img)
+	return layout, lines, nil
 }
 
-func calculateFontSize(f PlaceholderFlags, text string, img draw.Image) (float64, float64, float64, error) {
-	maxW := int(math.RoundToEven(float64(f.W) * (1 - float64(f.Padding)*2/100)))
-	maxH := int(math.RoundToEven(float64(f.H) * (1 - float64(f.Padding)*2/100)))
-	fontsize := float64(maxH)
+func calculateStrokeColor(f PlaceholderFlags, textColor color.Color) color.Color {
+	if strings.HasPrefix(f.StrokeColor, AutoColor) {
+		return contrastColor(textColor)
+	}
+	c, ok := calculatePlaceholderColor(f.StrokeColor, TransparentColor)
+	if !ok {
+		f.logger().Warn("Unsupported stroke color, fallback to auto contrast", slog.String("color", f.StrokeColor))
+		return contrastColor(textColor)
+	}
+	return c
+}
 
-	// Find the biggest matching tff size for the requested height.
-	height := calculateFontHeight(fontsize)
-	iter := float64(1)
-	for int(height) > maxH {
-		fontsize -= 2
-		oldHeight := height
-		height = calculateFontHeight(fontsize)
-		if iter < 1 {
+func calculateShadowColor(f PlaceholderFlags) color.Color {
+	c, ok := calculatePlaceholderColor(f.ShadowColor, TransparentColor)
+	if !ok {
+		f.logger().Warn("Unsupported shadow color, fallback to transparent", slog.String("color", f.ShadowColor))
+	}
+	return c
+}
+
+// textLayout is the text wrapped into lines at a font size.
+type textLayout struct {
+	face     *cachedFace
+	fontsize float64
+	lines    []string
+	// height of a line.
+	height float64
+	// lineAdvance is the distance between the baselines of two lines.
+	lineAdvance float64
+	// spacing is the extra space between characters, in pixel.
+	spacing float64
+	// width of the widest line.
+	width float64
+	// maxW and maxH are the size of the padded area.
+	maxW float64
+	maxH float64
+}
+
+// measure returns the advance width of the line, including the letter spacing.
+func (l textLayout) measure(line string) float64 {
+	return l.face.measure(line) + l.spacing*float64(max(utf8.RuneCountInString(line)-1, 0))
+}
+
+// layoutText finds the biggest font size that the wrapped text fits the padded area.
+// If the text does not fit at the minimum font size, then it is truncated with an ellipsis.
+// The search stops with the error of the context when it is done.
+func layoutText(ctx context.Context, f PlaceholderFlags, text string) (textLayout, error) {
+	maxW := math.RoundToEven(float64(f.W) * (1 - float64(f.Padding)*2/100))
+	maxH := math.RoundToEven(float64(f.H) * (1 - float64(f.Padding)*2/100))
+	maxLines := max(f.MaxLines, 1)
+	// A minimum font size taller than the area would overflow it.
+	minFontSize := min(max(f.MinFontSize, 1), max(maxH, 1))
+	paragraphs := strings.Split(strings.ReplaceAll(text, `\n`, "\n"), "\n")
+
+	fits := func(layout textLayout) bool {
+		return len(layout.lines) <= maxLines &&
+			layout.height+float64(len(layout.lines)-1)*layout.lineAdvance <= maxH &&
+			layout.width <= maxW
+	}
+	// Binary search the biggest font size that fits, as a smaller font size never wraps into more lines.
+	lo, hi := int(math.Ceil(minFontSize)), int(maxH)
+	var best *textLayout
+	for lo <= hi {
+		if err := ctx.Err(); err != nil {
+			return textLayout{}, err
+		}
+		fontsize := lo + (hi-lo)/2
+		// A single line must fit the height, skip wrapping if it doesn't.
+		if f.font().face(float64(fontsize)).height > maxH {
+			hi = fontsize - 1
 			continue
 		}
-		reductionRate := math.Ceil(oldHeight-height) / iter
-		iter = math.Floor((math.Ceil(height) - math.Floor(float64(maxH))) / reductionRate)
-		if iter > 1 {
-			fontsize -= iter * 2
+		if layout := wrapText(f, paragraphs, float64(fontsize), maxW, maxH); fits(layout) {
+			best = &layout
+			lo = fontsize + 1
+			continue
 		}
+		hi = fontsize - 1
+	}
+	if best != nil {
+		return *best, nil
 	}
 
-	face := truetype.NewFace(tff, &truetype.Options{
-		Size: fontsize,
-	})
-	drawer := font.Drawer{
-		Face: face,
-		Dst:  img,
-		Src:  image.NewUniform(&image.Uniform{C: color.Transparent}),
-		Dot:  freetype.Pt(0, 0),
-	}
-	// Find the biggest matching tff size for the requested width.
-	actWidth := float64(drawer.MeasureString(text)) / 64
-	iter = float64(1)
-	for int(actWidth) > maxW {
-		if err := face.Close(); err != nil {
-			panic(err)
-		}
-		fontsize -= 2
-		face = truetype.NewFace(tff, &truetype.Options{
-			Size: fontsize,
-		})
-		drawer.Face = face
-		oldWidth := actWidth
-		actWidth = float64(drawer.MeasureString(text)) / 64
-		if iter < 1 {
+	layout := wrapText(f, paragraphs, minFontSize, maxW, maxH)
+	if fits(layout) {
+		return layout, nil
+	}
+	return truncateText(layout, maxLines), nil
+}
+
+// wrapText wraps each paragraph into lines not wider than maxW, a single word wider than maxW is kept on its own line.
+func wrapText(f PlaceholderFlags, paragraphs []string, fontsize float64, maxW float64, maxH float64) textLayout {
+	face := f.font().face(fontsize)
+	lineHeight := f.LineHeight
+	if lineHeight <= 0 {
+		lineHeight = 1
+	}
+	layout := textLayout{
+		face:        face,
+		fontsize:    fontsize,
+		height:      face.height,
+		lineAdvance: face.height * lineHeight,
+		spacing:     fontsize * f.LetterSpacing,
+		maxW:        maxW,
+		maxH:        maxH,
+	}
+	for _, paragraph := range paragraphs {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			layout.lines = append(layout.lines, "")
 			continue
 		}
-		reductionRate := math.Ceil(oldWidth-actWidth) / iter
-		iter = math.Floor((math.Ceil(actWidth) - math.Floor(float64(maxW))) / reductionRate)
-		if iter > 1 {
-			fontsize -= iter * 2
+		line := words[0]
+		for _, word := range words[1:] {
+			if candidate := line + " " + word; layout.measure(candidate) <= maxW {
+				line = candidate
+				continue
+			}
+			layout.lines = append(layout.lines, line)
+			line = word
 		}
+		layout.lines = append(layout.lines, line)
+	}
+	for _, line := range layout.lines {
+		layout.width = max(layout.width, layout.measure(line))
 	}
+	return layout
+}
+
+// truncateText drops the lines that do not fit and shortens the lines that are too wide, marking them with an ellipsis.
+func truncateText(layout textLayout, maxLines int) textLayout {
+	const ellipsis = "…"
+	measure := layout.measure
+	maxW, maxH := layout.maxW, layout.maxH
+
+	lines := maxLines
+	if layout.lineAdvance > 0 {
+		lines = min(lines, 1+int(math.Floor((maxH-layout.height)/layout.lineAdvance)))
+	}
+	lines = max(lines, 1)
+	truncated := len(layout.lines) > lines
+	if truncated {
+		layout.lines = layout.lines[:lines]
+	}
+
+	layout.width = 0
+	for i, line := range layout.lines {
+		last := truncated && i == len(layout.lines)-1
+		if last || measure(line) > maxW {
+			runes := []rune(line)
+			for len(runes) > 0 && measure(string(runes)+ellipsis) > maxW {
+				runes = runes[:len(runes)-1]
+			}
+			line = strings.TrimRight(string(runes), " ") + ellipsis
+			layout.lines[i] = line
+		}
+		layout.width = max(layout.width, measure(line))
+	}
+	return layout
+}
 
-	if err := face.Close(); err != nil {
-		panic(err)
+// newPlaceholderRand creates the random source of the auto colors.
+// It is seeded by the text and the dimension, so the same invocation always generates the same placeholder.
+func newPlaceholderRand(seed string, text string, dimStr string) *rand.Rand {
+	h := fnv.New64a()
+	for _, s := range []string{seed, text, dimStr} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
 	}
-	face = truetype.NewFace(tff, &truetype.Options{
-		Size: fontsize,
-	})
-	defer face.Close()
-	// Calculate offset based on bounds.
-	bound, adv := drawer.BoundString(text)
-	yBaselineToCenterOffset := float64(bound.Max.Y+bound.Min.Y) / 2
-	return fontsize, float64(adv) / 2 / 64, yBaselineToCenterOffset / 64, nil
+	return rand.New(rand.NewPCG(h.Sum64(), 0))
 }
 
-func calculateFontHeight(fontsize float64) float64 {
-	face := truetype.NewFace(tff, &truetype.Options{
-		Size: fontsize,
-	})
-	defer face.Close()
-	return float64(face.Metrics().Height) / 64
+// splitPlaceholderTextColor splits the <color> suffix from the text.
+func splitPlaceholderTextColor(text string, dimStr string) (string, string) {
+	cname := placeholderTextColorRegex.FindString(text)
+	if cname == "" {
+		return text, ""
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(text, cname))
+	if text == "" {
+		text = dimStr
+	}
+	return text, cname[1 : len(cname)-1]
 }
 
-func calculatePlaceholderTextColor(text string, bg color.Color, dimStr string) (string, color.Color) {
-	if cname := placeholderTextColorRegex.FindString(text); cname != "" {
-		c, ok := calculatePlaceholderColor(cname[1:len(cname)-1], TransparentColor)
+// PlaceholderTextColor returns the color of the <color> suffix of the text, empty if none.
+func PlaceholderTextColor(text string) string {
+	if text == noneText {
+		return ""
+	}
+	_, cname := splitPlaceholderTextColor(text, "")
+	return cname
+}
+
+// calculatePlaceholderColors returns the background and the text color.
+// The auto colors are picked randomly, from colors that meet the min contrast if specified.
+func calculatePlaceholderColors(f PlaceholderFlags, textColorName string, rng *rand.Rand) (color.Color, color.Color) {
+	var textColor color.Color
+	autoText := strings.HasPrefix(textColorName, AutoColor)
+	if textColorName != "" && !autoText {
+		c, ok := calculatePlaceholderColor(textColorName, TransparentColor)
 		if ok {
-			text := strings.TrimSpace(strings.TrimSuffix(text, cname))
-			if text == "" {
-				text = dimStr
-			}
-			return text, c
+			textColor = c
+		} else {
+			f.logger().Warn("Unsupported text color, fallback to auto contrast",
+				slog.String("color", textColorName))
 		}
-		slog.Warn("Unsupported text color, fallback to auto contrast",
-			slog.String("color", cname))
 	}
-	// Transparent.
-	if bg == color.Transparent {
-		return text, color.Black
+
+	var bgColor color.Color
+	if strings.HasPrefix(f.Background, AutoColor) {
+		bgColor = pickAutoColor(f.logger(), rng, f.MinContrast, func(c color.Color) color.Color {
+			if textColor != nil {
+				return textColor
+			}
+			return contrastColor(c)
+		})
+	} else {
+		bgColor = calculatePlaceholderBackgroundColor(f.logger(), f.Background)
+	}
+
+	switch {
+	case textColor != nil:
+		return bgColor, textColor
+	case autoText:
+		return bgColor, pickAutoColor(f.logger(), rng, f.MinContrast, func(color.Color) color.Color {
+			return bgColor
+		})
+	case bgColor == color.Transparent:
+		return bgColor, color.Black
+	}
+	return bgColor, contrastColor(bgColor)
+}
+
+// pickAutoColor picks a random material color.
+// If minContrast is specified, only colors having at least minContrast ratio with the color returned by against are picked.
+func pickAutoColor(log *slog.Logger, rng *rand.Rand, minContrast float64, against func(color.Color) color.Color) color.Color {
+	names := matcolornames.Names
+	if minContrast > 0 {
+		filtered := make([]string, 0, len(names))
+		for _, name := range names {
+			c := matcolornames.Map[name]
+			if contrastRatio(c, against(c)) >= minContrast {
+				filtered = append(filtered, name)
+			}
+		}
+		if len(filtered) > 0 {
+			names = filtered
+		} else {
+			log.Warn("No color meets the contrast target, ignoring it", slog.Float64("contrast", minContrast))
+		}
 	}
-	return text, contrastColor(bg)
+	return matcolornames.Map[names[rng.IntN(len(names))]]
 }
 
-func calculatePlaceholderBackgroundColor(bg string) color.Color {
+func calculatePlaceholderBackgroundColor(log *slog.Logger, bg string) color.Color {
 	c, ok := calculatePlaceholderColor(bg, TransparentColor)
 	if ok {
 		return c
 	}
-	slog.Warn("Unsupported color, fallback to default",
+	log.Warn("Unsupported color, fallback to default",
 		slog.String("color", bg),
 		slog.String("default", BackgroundDefaultColor))
 	c, _ = calculatePlaceholderColor(BackgroundDefaultColor, TransparentColor)
 	return c
 }
 
+// calculatePlaceholderColor parses the color, the auto color is not supported and must be handled by the caller.
 func calculatePlaceholderColor(cname string, fallback string) (color.Color, bool) {
-	if strings.HasPrefix(cname, AutoColor) {
-		i := rand.Intn(len(matcolornames.Names))
-		return matcolornames.Map[matcolornames.Names[i]], true
-	}
-
 	if cname == TransparentColor {
 		return color.Transparent, true
 	}
@@ -268,8 +638,49 @@ func calculatePlaceholderColor(cname string, fallback string) (color.Color, bool
 	return calculatePlaceholderColor(fallback, TransparentColor)
 }
 
+// CheckColor returns ErrInvalidColor if the color is not supported.
+// If auto is true, the auto color with an optional fallback color, for example auto,#ffffff, is also supported.
+func CheckColor(cname string, auto bool) error {
+	if auto && strings.HasPrefix(cname, AutoColor) {
+		fallback := strings.TrimPrefix(cname, AutoColor)
+		if fallback == "" {
+			return nil
+		}
+		fallback, ok := strings.CutPrefix(fallback, ",")
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrInvalidColor, cname)
+		}
+		cname = strings.TrimSpace(fallback)
+	}
+	if _, ok := calculatePlaceholderColor(cname, ""); !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidColor, cname)
+	}
+	return nil
+}
+
 // Chooses a contrasting color (black or white) based on luminance
 func contrastColor(c color.Color) color.Color {
+	if relativeLuminance(c) > 0.5 {
+		return color.RGBA{
+			R: 18, G: 18, B: 18, A: 255,
+		}
+	}
+	return color.RGBA{
+		R: 250, G: 250, B: 250, A: 255,
+	}
+}
+
+// contrastRatio returns the WCAG contrast ratio of the two colors, from 1 to 21.
+func contrastRatio(c1 color.Color, c2 color.Color) float64 {
+	l1, l2 := relativeLuminance(c1), relativeLuminance(c2)
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05)
+}
+
+// relativeLuminance returns the WCAG relative luminance of the color.
+func relativeLuminance(c color.Color) float64 {
 	r, g, b, _ := c.RGBA()
 	rf, gf, bf := float64(r)/65535, float64(g)/65535, float64(b)/65535
 	adjust := func(val float64) float64 {
@@ -281,13 +692,5 @@ func contrastColor(c color.Color) color.Color {
 	rLinear := adjust(rf)
 	gLinear := adjust(gf)
 	bLinear := adjust(bf)
-	relativeLuminance := 0.2126*rLinear + 0.7152*gLinear + 0.0722*bLinear
-	if relativeLuminance > 0.5 {
-		return color.RGBA{
-			R: 18, G: 18, B: 18, A: 255,
-		}
-	}
-	return color.RGBA{
-		R: 250, G: 250, B: 250, A: 255,
-	}
+	return 0.2126*rLinear + 0.7152*gLinear + 0.0722*bLinear
 }
@@ -0,0 +1,89 @@
+package icon
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestCalculatePlaceholderColorsDeterministic(t *testing.T) {
+	f := PlaceholderFlags{W: 300, H: 250, OutputFlags: OutputFlags{Background: AutoColor}}
+	bg1, text1 := calculatePlaceholderColors(f, AutoColor, newPlaceholderRand("", "hello", "300x250"))
+	bg2, text2 := calculatePlaceholderColors(f, AutoColor, newPlaceholderRand("", "hello", "300x250"))
+	if bg1 != bg2 || text1 != text2 {
+		t.Errorf("expected same colors for same text, got %v/%v and %v/%v", bg1, text1, bg2, text2)
+	}
+}
+
+func TestCalculatePlaceholderColorsMinContrast(t *testing.T) {
+	f := PlaceholderFlags{W: 300, H: 250, MinContrast: 7, OutputFlags: OutputFlags{Background: AutoColor}}
+	for _, text := range []string{"a", "b", "c", "d", "e", "f"} {
+		bg, _ := calculatePlaceholderColors(f, "white", newPlaceholderRand("", text, "300x250"))
+		if r := contrastRatio(bg, color.White); r < 7 {
+			t.Errorf("%q: expected contrast >= 7, got %.2f", text, r)
+		}
+	}
+}
+
+func TestLayoutText(t *testing.T) {
+	tests := []struct {
+		name      string
+		f         PlaceholderFlags
+		text      string
+		lines     int
+		truncated bool
+	}{
+		{name: "single line", f: PlaceholderFlags{W: 300, H: 250, MaxLines: 3}, text: "300x250", lines: 1},
+		{name: "explicit break", f: PlaceholderFlags{W: 300, H: 250, MaxLines: 3}, text: `Line one\nLine two`, lines: 2},
+		{name: "wrap", f: PlaceholderFlags{W: 320, H: 50, MaxLines: 2}, text: "The quick brown fox jumps over the lazy dog", lines: 2},
+		{name: "letter spacing", f: PlaceholderFlags{W: 300, H: 250, MaxLines: 3, LetterSpacing: 0.5}, text: "spacing", lines: 1},
+		{name: "ellipsis", f: PlaceholderFlags{W: 320, H: 50, MaxLines: 2, MinFontSize: 20, OutputFlags: OutputFlags{Padding: 10}}, text: "The quick brown fox jumps over the lazy dog again", lines: 1, truncated: true},
+		{name: "min font size taller than height", f: PlaceholderFlags{W: 300, H: 40, MaxLines: 1, MinFontSize: 500}, text: "Hi", lines: 1},
+	}
+
+	for _, test := range tests {
+		layout, err := layoutText(context.Background(), test.f, test.text)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(layout.lines) != test.lines {
+			t.Errorf("%s: expected %d lines, got %q", test.name, test.lines, layout.lines)
+		}
+		if truncated := strings.HasSuffix(layout.lines[len(layout.lines)-1], "…"); truncated != test.truncated {
+			t.Errorf("%s: expected truncated %v, got %q", test.name, test.truncated, layout.lines)
+		}
+		if layout.width > float64(test.f.W) {
+			t.Errorf("%s: expected width <= %d, got %.2f", test.name, test.f.W, layout.width)
+		}
+		if layout.fontsize > float64(test.f.H) {
+			t.Errorf("%s: expected font size <= %d, got %.2f", test.name, test.f.H, layout.fontsize)
+		}
+	}
+}
+
+func TestLayoutTextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f := PlaceholderFlags{W: 1200, H: 630, MaxLines: 3}
+	if _, err := layoutText(ctx, f, "The quick brown fox jumps over the lazy dog"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+}
+
+func BenchmarkLayoutText(b *testing.B) {
+	f := PlaceholderFlags{W: 1200, H: 630, MaxLines: 3, OutputFlags: OutputFlags{Padding: 10}}
+	for b.Loop() {
+		_, _ = layoutText(context.Background(), f, "The quick brown fox jumps over the lazy dog")
+	}
+}
+
+func BenchmarkLayoutTextParallel(b *testing.B) {
+	f := PlaceholderFlags{W: 1200, H: 630, MaxLines: 3, OutputFlags: OutputFlags{Padding: 10}}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = layoutText(context.Background(), f, "The quick brown fox jumps over the lazy dog")
+		}
+	})
+}
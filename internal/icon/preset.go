@@ -0,0 +1,110 @@
+package icon
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// PlaceholderPreset is a named placeholder size.
+type PlaceholderPreset struct {
+	Name        string
+	W           int
+	H           int
+	Description string
+}
+
+var PlaceholderPresets = []PlaceholderPreset{
+	{Name: "og", W: 1200, H: 630, Description: "Open Graph image"},
+	{Name: "twitter-card", W: 1200, H: 628, Description: "X/Twitter large summary card"},
+	{Name: "facebook-cover", W: 820, H: 312, Description: "Facebook page cover"},
+	{Name: "youtube-thumbnail", W: 1280, H: 720, Description: "YouTube video thumbnail"},
+	{Name: "instagram-post", W: 1080, H: 1080, Description: "Instagram square post"},
+	{Name: "instagram-story", W: 1080, H: 1920, Description: "Instagram story"},
+	{Name: "iab-leaderboard", W: 728, H: 90, Description: "IAB leaderboard ad"},
+	{Name: "iab-billboard", W: 970, H: 250, Description: "IAB billboard ad"},
+	{Name: "iab-medium-rectangle", W: 300, H: 250, Description: "IAB medium rectangle ad"},
+	{Name: "iab-large-rectangle", W: 336, H: 280, Description: "IAB large rectangle ad"},
+	{Name: "iab-half-page", W: 300, H: 600, Description: "IAB half page ad"},
+	{Name: "iab-skyscraper", W: 120, H: 600, Description: "IAB skyscraper ad"},
+	{Name: "iab-wide-skyscraper", W: 160, H: 600, Description: "IAB wide skyscraper ad"},
+	{Name: "iab-mobile-banner", W: 320, H: 50, Description: "IAB mobile banner ad"},
+	{Name: "iphone-15", W: 1179, H: 2556, Description: "iPhone 15 screen"},
+	{Name: "iphone-15-pro-max", W: 1290, H: 2796, Description: "iPhone 15 Pro Max screen"},
+	{Name: "pixel-8", W: 1080, H: 2400, Description: "Google Pixel 8 screen"},
+	{Name: "hd", W: 1280, H: 720, Description: "HD 720p"},
+	{Name: "fhd", W: 1920, H: 1080, Description: "Full HD 1080p"},
+	{Name: "qhd", W: 2560, H: 1440, Description: "QHD 1440p"},
+	{Name: "4k", W: 3840, H: 2160, Description: "4K UHD"},
+}
+
+// MaxPlaceholderDensity is the maximum density of the @Nx suffix.
+const MaxPlaceholderDensity = 4
+
+var (
+	placeholderSizeRegex    = regexp.MustCompile(`^([1-9][0-9]*)x([1-9][0-9]*)$`)
+	placeholderAspectRegex  = regexp.MustCompile(`^([1-9][0-9]*(?:\.[0-9]+)?):([1-9][0-9]*(?:\.[0-9]+)?)@([1-9][0-9]*)$`)
+	placeholderDensityRegex = regexp.MustCompile(`^(.+)@([1-9])x$`)
+)
+
+// PlaceholderSize is the size of a placeholder, at a density.
+type PlaceholderSize struct {
+	// W and H are the size at 1x density.
+	W int
+	H int
+	// Density multiplies the size of the output image, 0 for 1x.
+	Density int
+}
+
+// ParsePlaceholderSize parses the placeholder size, which is either:
+//   - WxH, for example 300x250.
+//   - a preset name, for example og.
+//   - an aspect ratio with the width, for example 16:9@1200.
+//
+// With the @Nx density suffix, for example 300x250@2x, a size is returned for each density from 1x to Nx.
+func ParsePlaceholderSize(size string) ([]PlaceholderSize, bool) {
+	density := 0
+	if m := placeholderDensityRegex.FindStringSubmatch(size); m != nil {
+		size = m[1]
+		density, _ = strconv.Atoi(m[2])
+		if density > MaxPlaceholderDensity {
+			return nil, false
+		}
+	}
+
+	w, h, ok := parsePlaceholderBaseSize(size)
+	if !ok {
+		return nil, false
+	}
+	if density == 0 {
+		return []PlaceholderSize{{W: w, H: h}}, true
+	}
+	sizes := make([]PlaceholderSize, 0, density)
+	for d := 1; d <= density; d++ {
+		sizes = append(sizes, PlaceholderSize{W: w, H: h, Density: d})
+	}
+	return sizes, true
+}
+
+func parsePlaceholderBaseSize(size string) (int, int, bool) {
+	if m := placeholderSizeRegex.FindStringSubmatch(size); m != nil {
+		w, errW := strconv.Atoi(m[1])
+		h, errH := strconv.Atoi(m[2])
+		return w, h, errW == nil && errH == nil
+	}
+	if m := placeholderAspectRegex.FindStringSubmatch(size); m != nil {
+		rw, _ := strconv.ParseFloat(m[1], 64)
+		rh, _ := strconv.ParseFloat(m[2], 64)
+		w, err := strconv.Atoi(m[3])
+		if err != nil {
+			return 0, 0, false
+		}
+		return w, max(1, int(math.Round(float64(w)*rh/rw))), true
+	}
+	for _, p := range PlaceholderPresets {
+		if p.Name == size {
+			return p.W, p.H, true
+		}
+	}
+	return 0, 0, false
+}
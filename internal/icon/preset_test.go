@@ -0,0 +1,30 @@
+package icon
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePlaceholderSize(t *testing.T) {
+	tests := []struct {
+		size string
+		exp  []PlaceholderSize
+	}{
+		{size: "300x250", exp: []PlaceholderSize{{W: 300, H: 250}}},
+		{size: "og", exp: []PlaceholderSize{{W: 1200, H: 630}}},
+		{size: "16:9@1200", exp: []PlaceholderSize{{W: 1200, H: 675}}},
+		{size: "1.91:1@1200", exp: []PlaceholderSize{{W: 1200, H: 628}}},
+		{size: "300x250@2x", exp: []PlaceholderSize{{W: 300, H: 250, Density: 1}, {W: 300, H: 250, Density: 2}}},
+		{size: "hd@1x", exp: []PlaceholderSize{{W: 1280, H: 720, Density: 1}}},
+		{size: "300x250@9x"},
+		{size: "0x250"},
+		{size: "hello"},
+	}
+
+	for _, test := range tests {
+		got, ok := ParsePlaceholderSize(test.size)
+		if ok != (test.exp != nil) || !slices.Equal(got, test.exp) {
+			t.Errorf("%q: expected %v, got %v (%v)", test.size, test.exp, got, ok)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package icon
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/mawngo/piconic/internal/utils"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// writePlaceholderSVG writes the placeholder as svg, using <rect>, <path> and <text> elements.
+// The text is laid out using the font metrics, so it matches the raster output when the viewer has the same font.
+func writePlaceholderSVG(ctx context.Context, w io.Writer, f PlaceholderFlags, text string, bg color.Color, textColor color.Color) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, f.W, f.H, f.W, f.H)
+	b.WriteString("\n")
+	if f.Round > 0 {
+		// Same radius as utils.RoundImage.
+		r := float64(min(f.W, f.H)) / 2 * float64(f.Round) / 100
+		fmt.Fprintf(&b, `<clipPath id="round"><rect width="%d" height="%d" rx="%s"/></clipPath>`+"\n", f.W, f.H, formatSvgNumber(r))
+		b.WriteString(`<g clip-path="url(#round)">` + "\n")
+	}
+	if bg != color.Transparent {
+		fmt.Fprintf(&b, `<rect width="%d" height="%d"%s/>`+"\n", f.W, f.H, svgPaint("fill", bg))
+	}
+
+	layers, labels := calculatePattern(f, bg)
+	for _, layer := range layers {
+		fmt.Fprintf(&b, `<path d="%s"%s/>`+"\n", svgPath(layer.polys), svgPaint("fill", layer.c))
+	}
+	for _, label := range labels {
+		fmt.Fprintf(&b, `<text x="%s" y="%s" font-size="%s"%s%s>`,
+			formatSvgNumber(label.x), formatSvgNumber(label.y), formatSvgNumber(label.fontsize), svgFontAttrs(f.font()), svgPaint("fill", label.c))
+		_ = xml.EscapeText(&b, []byte(label.text))
+		b.WriteString("</text>\n")
+	}
+
+	if text != "" {
+		layout, lines, err := placeText(ctx, f, text)
+		if err != nil {
+			return err
+		}
+		anchor := "middle"
+		switch f.AlignX {
+		case AlignStart:
+			anchor = "start"
+		case AlignEnd:
+			anchor = "end"
+		}
+		fmt.Fprintf(&b, `<g font-size="%s"%s text-anchor="%s"`, formatSvgNumber(layout.fontsize), svgFontAttrs(f.font()), anchor)
+		if layout.spacing != 0 {
+			fmt.Fprintf(&b, ` letter-spacing="%s"`, formatSvgNumber(layout.spacing))
+		}
+		b.WriteString(">\n")
+
+		writeLines := func(attrs string) {
+			fmt.Fprintf(&b, "<g%s>", attrs)
+			for _, line := range lines {
+				fmt.Fprintf(&b, `<text x="%s" y="%s">`, formatSvgNumber(line.anchorX), formatSvgNumber(line.y))
+				_ = xml.EscapeText(&b, []byte(line.text))
+				b.WriteString("</text>")
+			}
+			b.WriteString("</g>\n")
+		}
+		stroke := func(c color.Color) string {
+			if f.StrokeWidth <= 0 {
+				return ""
+			}
+			// The stroke is centered on the outline, so it is doubled and drawn below the fill.
+			return fmt.Sprintf(`%s stroke-width="%d" stroke-linejoin="round" paint-order="stroke"`, svgPaint("stroke", c), f.StrokeWidth*2)
+		}
+		if f.ShadowX != 0 || f.ShadowY != 0 {
+			shadowColor := calculateShadowColor(f)
+			writeLines(fmt.Sprintf(` transform="translate(%d %d)"%s%s`, f.ShadowX, f.ShadowY, svgPaint("fill", shadowColor), stroke(shadowColor)))
+		}
+		writeLines(svgPaint("fill", textColor) + stroke(calculateStrokeColor(f, textColor)))
+		b.WriteString("</g>\n")
+	}
+
+	if f.Round > 0 {
+		b.WriteString("</g>\n")
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// svgPaint returns the paint attribute of the color, with its opacity if not opaque.
+func svgPaint(attr string, c color.Color) string {
+	_, _, _, a := c.RGBA()
+	if a == 0 {
+		return fmt.Sprintf(` %s="none"`, attr)
+	}
+	paint := fmt.Sprintf(` %s="%s"`, attr, utils.FormatHexColor(c))
+	if a < 0xffff {
+		paint += fmt.Sprintf(` %s-opacity="%s"`, attr, formatSvgNumber(float64(a)/0xffff))
+	}
+	return paint
+}
+
+// svgFontAttrs returns the font family and weight attributes of the primary font.
+func svgFontAttrs(f *Font) string {
+	attrs := ` font-family="sans-serif"`
+	if family := f.family(); family != "" {
+		attrs = fmt.Sprintf(` font-family="%s, sans-serif"`, family)
+	}
+	if f.weight > 0 {
+		attrs += fmt.Sprintf(` font-weight="%d"`, f.weight)
+	}
+	return attrs
+}
+
+// svgPath returns the path data of the polygons.
+func svgPath(polys [][][2]float64) string {
+	var b strings.Builder
+	for _, pts := range polys {
+		for i, p := range pts {
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			b.WriteString(cmd + formatSvgNumber(p[0]) + " " + formatSvgNumber(p[1]))
+		}
+		b.WriteString("Z")
+	}
+	return b.String()
+}
+
+// formatSvgNumber formats the number with at most 2 decimals.
+func formatSvgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,264 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/utils"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"image"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// GlyphPrefix is the prefix of glyph source, in the form of glyph:<font>#<codepoint-or-name>.
+const GlyphPrefix = "glyph:"
+
+var ErrGlyphNotFound = errors.New("glyph not found")
+
+// fonts caches the parsed fonts by path, as many glyphs are usually rendered from the same font.
+// The cached font is replaced when its file is modified, so the cache only grows with the number of font files.
+// sfnt.Font is safe for concurrent use.
+var fonts sync.Map
+
+// cachedFont is the parsed font, and the size and modification time of its file when parsed.
+type cachedFont struct {
+	font    *sfnt.Font
+	size    int64
+	modTime time.Time
+}
+
+// IsGlyph reports whether the path is a glyph source.
+func IsGlyph(path string) bool {
+	return strings.HasPrefix(path, GlyphPrefix)
+}
+
+// parseGlyphPath splits the glyph source into the font path and the glyph.
+func parseGlyphPath(path string) (string, string, error) {
+	spec := strings.TrimPrefix(path, GlyphPrefix)
+	i := strings.LastIndex(spec, "#")
+	if i <= 0 || i == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid glyph %q, must be in the form of %s<font>#<codepoint-or-name>", path, GlyphPrefix)
+	}
+	return spec[:i], spec[i+1:], nil
+}
+
+func configGlyph(path string, limits Limits) (Source, error) {
+	src := Source{
+		Path:   path,
+		Limits: limits,
+	}
+	img, err := decodeGlyph(path, limits)
+	if err != nil {
+		return src, err
+	}
+	src.Width = img.Width
+	src.Height = img.Height
+	src.Vector = img.Vector != nil
+	return src, nil
+}
+
+func decodeGlyph(path string, limits Limits) (DecodedImage, error) {
+	img := DecodedImage{
+		Path: path,
+	}
+	fontPath, glyph, err := parseGlyphPath(path)
+	if err != nil {
+		return img, err
+	}
+	img.Path = fontPath
+	img.Name = strings.TrimSuffix(filepath.Base(fontPath), filepath.Ext(fontPath)) + "-" + glyph
+
+	f, err := loadFont(fontPath, limits)
+	if err != nil {
+		return img, err
+	}
+	var buf sfnt.Buffer
+	idx, err := findGlyph(f, &buf, glyph)
+	if err != nil {
+		return img, err
+	}
+
+	// Load the glyph at the units per em size, so 1px is 1 font unit.
+	ppem := fixed.I(int(f.UnitsPerEm()))
+	segments, err := f.LoadGlyph(&buf, idx, ppem, nil)
+	if err != nil {
+		return img, err
+	}
+	bounds, advance, err := f.GlyphBounds(&buf, idx, ppem, font.HintingNone)
+	if err != nil {
+		return img, err
+	}
+	metrics, err := f.Metrics(&buf, ppem, font.HintingNone)
+	if err != nil {
+		return img, err
+	}
+	// The em box of the glyph, extended to the ink bounds if the glyph overflows it.
+	box := fixed.Rectangle26_6{
+		Min: fixed.Point26_6{X: 0, Y: -metrics.Ascent},
+		Max: fixed.Point26_6{X: advance, Y: metrics.Descent},
+	}.Union(bounds)
+
+	v := glyphVector{
+		segments: append(sfnt.Segments(nil), segments...),
+		bounds: Rect{
+			X: fixedToFloat(box.Min.X),
+			Y: fixedToFloat(box.Min.Y),
+			W: fixedToFloat(box.Max.X - box.Min.X),
+			H: fixedToFloat(box.Max.Y - box.Min.Y),
+		},
+		c: color.Black,
+	}
+	if v.bounds.W <= 0 || v.bounds.H <= 0 {
+		return img, fmt.Errorf("%w: empty glyph %q", ErrGlyphNotFound, glyph)
+	}
+	img.Width = int(v.bounds.W)
+	img.Height = int(v.bounds.H)
+	if err := limits.checkDimension(img.Width, img.Height); err != nil {
+		return img, err
+	}
+	img.Vector = v
+	return img, nil
+}
+
+// loadFont parses the font file, or returns the cached font if the file is not modified.
+func loadFont(path string, limits Limits) (*sfnt.Font, error) {
+	f, err := open(path, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	key := filepath.Clean(path)
+	if cached, ok := fonts.Load(key); ok {
+		if cached := cached.(cachedFont); cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+			return cached.font, nil
+		}
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	fonts.Store(key, cachedFont{font: parsed, size: info.Size(), modTime: info.ModTime()})
+	return parsed, nil
+}
+
+// findGlyph finds the glyph by codepoint (U+E88A, 0xe88a or the character itself) or by name in the post table.
+func findGlyph(f *sfnt.Font, buf *sfnt.Buffer, glyph string) (sfnt.GlyphIndex, error) {
+	if r, ok := parseCodepoint(glyph); ok {
+		idx, err := f.GlyphIndex(buf, r)
+		if err != nil {
+			return 0, err
+		}
+		if idx == 0 {
+			return 0, fmt.Errorf("%w: codepoint %U", ErrGlyphNotFound, r)
+		}
+		return idx, nil
+	}
+
+	for i := range f.NumGlyphs() {
+		idx := sfnt.GlyphIndex(i)
+		name, err := f.GlyphName(buf, idx)
+		if err != nil {
+			return 0, err
+		}
+		if name == glyph {
+			return idx, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: name %q", ErrGlyphNotFound, glyph)
+}
+
+func parseCodepoint(s string) (rune, bool) {
+	lower := strings.ToLower(s)
+	for _, prefix := range []string{"u+", "0x"} {
+		if !strings.HasPrefix(lower, prefix) {
+			continue
+		}
+		v, err := strconv.ParseUint(lower[len(prefix):], 16, 32)
+		if err != nil || v > utf8.MaxRune {
+			return 0, false
+		}
+		return rune(v), true
+	}
+	if utf8.RuneCountInString(s) == 1 {
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, true
+	}
+	return 0, false
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+// glyphVector renders the glyph outline, in font units.
+type glyphVector struct {
+	segments sfnt.Segments
+	bounds   Rect
+	c        color.Color
+}
+
+func (v glyphVector) Bounds() Rect {
+	return v.bounds
+}
+
+func (v glyphVector) Render(dst *image.RGBA, r Rect) {
+	b := dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 || r.W <= 0 || r.H <= 0 {
+		return
+	}
+	sx := float64(w) / r.W
+	sy := float64(h) / r.H
+	pt := func(p fixed.Point26_6) (float32, float32) {
+		return float32((fixedToFloat(p.X) - r.X) * sx), float32((fixedToFloat(p.Y) - r.Y) * sy)
+	}
+
+	z := vector.NewRasterizer(w, h)
+	z.DrawOp = draw.Over
+	for _, seg := range v.segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			z.MoveTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			z.LineTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			bx, by := pt(seg.Args[0])
+			cx, cy := pt(seg.Args[1])
+			z.QuadTo(bx, by, cx, cy)
+		case sfnt.SegmentOpCubeTo:
+			bx, by := pt(seg.Args[0])
+			cx, cy := pt(seg.Args[1])
+			dx, dy := pt(seg.Args[2])
+			z.CubeTo(bx, by, cx, cy, dx, dy)
+		}
+	}
+	z.Draw(dst, b, image.NewUniform(v.c), image.Point{})
+}
+
+// Recolor paints the glyph with the color c, the glyph is black by default.
+func (v glyphVector) Recolor(c color.Color, tint bool) (Vector, error) {
+	if tint {
+		c = utils.MultiplyColor(v.c, c)
+	}
+	v.c = c
+	return v, nil
+}
@@ -0,0 +1,89 @@
+package scan
+
+import (
+	"golang.org/x/image/font/gofont/goregular"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseGlyphPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		font  string
+		glyph string
+		ok    bool
+	}{
+		{path: "glyph:icons.ttf#home", font: "icons.ttf", glyph: "home", ok: true},
+		{path: "glyph:my#fonts/icons.otf#U+E88A", font: "my#fonts/icons.otf", glyph: "U+E88A", ok: true},
+		{path: "glyph:icons.ttf"},
+		{path: "glyph:icons.ttf#"},
+		{path: "glyph:#home"},
+	}
+
+	for _, test := range tests {
+		font, glyph, err := parseGlyphPath(test.path)
+		if (err == nil) != test.ok || font != test.font || glyph != test.glyph {
+			t.Errorf("%q: expected %q %q %v, got %q %q %v", test.path, test.font, test.glyph, test.ok, font, glyph, err)
+		}
+	}
+}
+
+func TestParseCodepoint(t *testing.T) {
+	tests := []struct {
+		s   string
+		exp rune
+		ok  bool
+	}{
+		{s: "U+E88A", exp: 0xe88a, ok: true},
+		{s: "0xf015", exp: 0xf015, ok: true},
+		{s: "★", exp: '★', ok: true},
+		{s: "a", exp: 'a', ok: true},
+		{s: "home"},
+		{s: "U+ZZZZ"},
+	}
+
+	for _, test := range tests {
+		got, ok := parseCodepoint(test.s)
+		if ok != test.ok || got != test.exp {
+			t.Errorf("%q: expected %U %v, got %U %v", test.s, test.exp, test.ok, got, ok)
+		}
+	}
+}
+
+func TestLoadFontReplacesModified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "font.ttf")
+	if err := os.WriteFile(path, goregular.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := loadFont(path, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := loadFont(path, Limits{}); err != nil || cached != first {
+		t.Fatalf("expected the cached font, got %p %v", cached, err)
+	}
+
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := loadFont(path, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded == first {
+		t.Error("expected the modified font to be parsed again")
+	}
+	entries := 0
+	fonts.Range(func(key, _ any) bool {
+		if key == path {
+			entries++
+		}
+		return true
+	})
+	if entries != 1 {
+		t.Errorf("expected 1 cached entry for the font, got %d", entries)
+	}
+}
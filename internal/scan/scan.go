@@ -1,24 +1,82 @@
 package scan
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
-	"github.com/srwiley/oksvg"
-	"github.com/srwiley/rasterx"
 	_ "golang.org/x/image/bmp"  // Enable support for bmp.
 	_ "golang.org/x/image/webp" // Enable support for webp.
 	"image"
+	"image/color"
 	_ "image/jpeg" // Enable support for jpeg.
 	_ "image/png"  // Enable support for bmp.
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 )
 
-func Img(dir string) <-chan DecodedImage {
-	ch := make(chan DecodedImage, 1)
+var ErrImageTooLarge = errors.New("image too large")
+
+// Stdin is the path reading the image from the standard input.
+const Stdin = "-"
+
+// stdinName is the name of the image read from stdin, used for the output file name.
+const stdinName = "stdin"
+
+// Limits of the input images, used to reject oversized input before decoding it.
+// Zero value means unlimited.
+type Limits struct {
+	MaxPixels   int64
+	MaxWidth    int
+	MaxHeight   int
+	MaxFileSize int64
+}
+
+func (l Limits) checkFileSize(info os.FileInfo) error {
+	if l.MaxFileSize > 0 && info.Size() > l.MaxFileSize {
+		return fmt.Errorf("%w: file size %d bytes exceeds max file size %d bytes", ErrImageTooLarge, info.Size(), l.MaxFileSize)
+	}
+	return nil
+}
+
+func (l Limits) checkDimension(w int, h int) error {
+	if l.MaxWidth > 0 && w > l.MaxWidth {
+		return fmt.Errorf("%w: width %d exceeds max width %d", ErrImageTooLarge, w, l.MaxWidth)
+	}
+	if l.MaxHeight > 0 && h > l.MaxHeight {
+		return fmt.Errorf("%w: height %d exceeds max height %d", ErrImageTooLarge, h, l.MaxHeight)
+	}
+	if l.MaxPixels > 0 && int64(w)*int64(h) > l.MaxPixels {
+		return fmt.Errorf("%w: %dx%d exceeds max pixels %d", ErrImageTooLarge, w, h, l.MaxPixels)
+	}
+	return nil
+}
+
+// Img scans the file or directory for images.
+// Only the image headers are read, the image data is decoded by calling Source.Decode.
+// Images exceeding the limits and files that cannot be read are sent with their Err set.
+func Img(dir string, limits Limits) <-chan Source {
+	ch := make(chan Source, 1)
+	if dir == Stdin {
+		src, err := configStdin(limits)
+		src.Err = err
+		ch <- src
+		close(ch)
+		return ch
+	}
+	if IsGlyph(dir) {
+		src, err := configGlyph(dir, limits)
+		src.Err = err
+		ch <- src
+		close(ch)
+		return ch
+	}
+
 	info, err := os.Stat(dir)
 	if err != nil {
-		slog.Error("Err scanning file(s)", slog.String("path", dir), slog.Any("err", err))
+		ch <- Source{Path: dir, Limits: limits, Err: err}
 		close(ch)
 		return ch
 	}
@@ -26,18 +84,15 @@ func Img(dir string) <-chan DecodedImage {
 	go func() {
 		defer close(ch)
 		if !info.IsDir() {
-			img, err := decode(dir)
-			if err != nil {
-				slog.Error("Err decoding image", slog.String("path", dir), slog.Any("err", err))
-				return
-			}
-			ch <- img
+			src, err := config(dir, limits)
+			src.Err = err
+			ch <- src
 			return
 		}
 
-		files, err := os.ReadDir(".")
+		files, err := os.ReadDir(dir)
 		if err != nil {
-			slog.Error("Err scanning dir", slog.String("path", dir), slog.Any("err", err))
+			ch <- Source{Path: dir, Limits: limits, Err: err}
 			return
 		}
 
@@ -46,74 +101,200 @@ func Img(dir string) <-chan DecodedImage {
 				continue
 			}
 			path := filepath.Join(dir, file.Name())
-			img, err := decode(path)
-			if err != nil {
-				slog.Error("Not a image", slog.String("path", path), slog.Any("err", err))
-				continue
-			}
-			ch <- img
+			src, err := config(path, limits)
+			src.Err = err
+			ch <- src
 		}
 	}()
 
 	return ch
 }
 
-func decode(path string) (DecodedImage, error) {
-	img := DecodedImage{
-		Path: path,
+// Source is an image file which dimension is known, but not yet decoded.
+type Source struct {
+	Path   string
+	Width  int
+	Height int
+	Limits Limits
+	// Vector is true if the source is rendered from vector, so its dimension is not its decoded size.
+	Vector bool
+	// Err is the error reading the source, its dimension is unknown and it cannot be decoded.
+	Err error
+	// data of the image read from stdin, nil for files.
+	data []byte
+}
+
+// Decode reads and decodes the whole image.
+// The limits are checked again, as the file may be changed since it was scanned.
+func (s Source) Decode() (DecodedImage, error) {
+	if s.Err != nil {
+		return DecodedImage{Path: s.Path}, s.Err
+	}
+	if s.data != nil {
+		img, err := DecodeReader(bytes.NewReader(s.data), s.Path, s.Limits)
+		img.Name = stdinName
+		return img, err
+	}
+	if IsGlyph(s.Path) {
+		return decodeGlyph(s.Path, s.Limits)
 	}
+	return decode(s.Path, s.Limits)
+}
+
+// open opens the file after checking its size.
+func open(path string, limits Limits) (*os.File, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return img, err
+		return nil, err
 	}
-	defer f.Close()
-	if filepath.Ext(path) == ".svg" {
-		return decodeSvg(f, path)
+	info, err := f.Stat()
+	if err == nil {
+		err = limits.checkFileSize(info)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
 	}
+	return f, nil
+}
 
-	config, _, err := image.DecodeConfig(f)
+func config(path string, limits Limits) (Source, error) {
+	src := Source{
+		Path:   path,
+		Limits: limits,
+	}
+	f, err := open(path, limits)
 	if err != nil {
-		return img, err
+		return src, err
 	}
-	img.Width = config.Width
-	img.Height = config.Height
+	defer f.Close()
+	return configReader(newSvgReader(f), src)
+}
 
-	_, err = f.Seek(0, 0)
+// configStdin reads the whole stdin, as it cannot be read again when decoding.
+func configStdin(limits Limits) (Source, error) {
+	src := Source{
+		Path:   Stdin,
+		Limits: limits,
+	}
+	var r io.Reader = os.Stdin
+	if limits.MaxFileSize > 0 {
+		r = io.LimitReader(r, limits.MaxFileSize+1)
+	}
+	data, err := io.ReadAll(r)
 	if err != nil {
-		panic(err)
+		return src, err
 	}
-	slog.Debug("Decoding image", slog.String("path", path), slog.String("dimension", fmt.Sprintf("%dx%d", img.Width, img.Height)))
-	imageData, _, err := image.Decode(f)
+	if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+		return src, fmt.Errorf("%w: stdin exceeds max file size %d bytes", ErrImageTooLarge, limits.MaxFileSize)
+	}
+	src.data = data
+	return configReader(newSvgReader(bytes.NewReader(data)), src)
+}
+
+// configReader reads the dimension of the image and checks the limits.
+func configReader(r *bufio.Reader, src Source) (Source, error) {
+	vector, ok, err := readSvg(r, src.Limits)
 	if err != nil {
-		return img, err
+		return src, err
+	}
+	if ok {
+		src.Width = int(vector.icon.ViewBox.W)
+		src.Height = int(vector.icon.ViewBox.H)
+		src.Vector = true
+		return src, src.Limits.checkDimension(src.Width, src.Height)
 	}
-	img.Image = imageData
 
-	return img, nil
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return src, err
+	}
+	src.Width = config.Width
+	src.Height = config.Height
+	return src, src.Limits.checkDimension(src.Width, src.Height)
 }
 
-func decodeSvg(f *os.File, path string) (DecodedImage, error) {
+func decode(path string, limits Limits) (DecodedImage, error) {
+	f, err := open(path, limits)
+	if err != nil {
+		return DecodedImage{Path: path}, err
+	}
+	defer f.Close()
+	return DecodeReader(f, path, limits)
+}
+
+// DecodeReader decodes the image from the reader, the path is only used to name the image.
+// The dimension limits are checked before decoding, the file size limit is not checked.
+func DecodeReader(rs io.ReadSeeker, path string, limits Limits) (DecodedImage, error) {
 	img := DecodedImage{
 		Path: path,
 	}
-	icon, err := oksvg.ReadIconStream(f)
+	r := newSvgReader(rs)
+	vector, ok, err := readSvg(r, limits)
+	if err != nil {
+		return img, err
+	}
+	if ok {
+		img.Width = int(vector.icon.ViewBox.W)
+		img.Height = int(vector.icon.ViewBox.H)
+		if err := limits.checkDimension(img.Width, img.Height); err != nil {
+			return img, err
+		}
+		img.Vector = vector
+		return img, nil
+	}
+
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return img, err
+	}
+	img.Width = config.Width
+	img.Height = config.Height
+	if err := limits.checkDimension(img.Width, img.Height); err != nil {
+		return img, err
+	}
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return img, err
+	}
+	slog.Debug("Decoding image", slog.String("path", path), slog.String("dimension", fmt.Sprintf("%dx%d", img.Width, img.Height)))
+	imageData, _, err := image.Decode(rs)
 	if err != nil {
 		return img, err
 	}
-	w := int(icon.ViewBox.W)
-	h := int(icon.ViewBox.H)
-	icon.SetTarget(0, 0, float64(w), float64(h))
-	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
-	icon.Draw(rasterx.NewDasher(w, h, rasterx.NewScannerGV(w, h, rgba, rgba.Bounds())), 1)
-	img.Image = rgba
-	img.Width = w
-	img.Height = h
+	img.Image = imageData
+
 	return img, nil
 }
 
+// DecodedImage is a decoded source image.
+// For vector source, the Image is nil and the Vector is used to render the image at the required resolution.
 type DecodedImage struct {
 	image.Image
+	Vector Vector
 	Width  int
 	Height int
 	Path   string
+	// Name of the image used for the output file name, empty to use the file name of the Path.
+	Name string
+}
+
+// Vector is a source image that can be rendered at any resolution.
+type Vector interface {
+	// Bounds returns the area of the image, in source units.
+	Bounds() Rect
+	// Render draws the area r of the image, in source units, scaled to fill the dst.
+	Render(dst *image.RGBA, r Rect)
+}
+
+// Recolorer is implemented by Vector that supports changing its colors.
+type Recolorer interface {
+	// Recolor returns a copy of the vector painted with the color c.
+	// If tint is true, the color is multiplied with the original colors instead.
+	Recolor(c color.Color, tint bool) (Vector, error)
+}
+
+// Rect is a rectangle in source units.
+type Rect struct {
+	X, Y, W, H float64
 }
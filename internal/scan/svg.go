@@ -0,0 +1,336 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/utils"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default size of svg image that does not specify its size, same as browsers.
+const (
+	svgDefaultWidth  = 300
+	svgDefaultHeight = 150
+)
+
+// svgSniffSize is the size of the content read to find the root element of svg documents.
+const svgSniffSize = 64 * 1024
+
+var (
+	ErrInvalidSvg          = errors.New("invalid svg")
+	ErrUnsupportedSvgPaint = errors.New("unsupported svg paint")
+)
+
+var (
+	gzipMagic         = []byte{0x1f, 0x8b}
+	svgSizeAttrRegex  = regexp.MustCompile(`\s(width|height)\s*=\s*("[^"]*"|'[^']*')`)
+	svgLengthRegex    = regexp.MustCompile(`^([+-]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?)\s*([a-zA-Z%]*)$`)
+	svgLengthUnitToPx = map[string]float64{
+		"":   1,
+		"px": 1,
+		"in": 96,
+		"cm": 96 / 2.54,
+		"mm": 96 / 25.4,
+		"q":  96 / 101.6,
+		"pt": 96.0 / 72,
+		"pc": 16,
+		"em": 16,
+		"ex": 8,
+	}
+)
+
+// readSvg reads the svg or gzip compressed svg document.
+// Returns false if the content is not a svg document.
+func readSvg(r *bufio.Reader, limits Limits) (svgVector, bool, error) {
+	if head, _ := r.Peek(len(gzipMagic)); bytes.Equal(head, gzipMagic) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return svgVector{}, false, err
+		}
+		defer zr.Close()
+		r = newSvgReader(zr)
+		if !isSvg(r) {
+			return svgVector{}, false, fmt.Errorf("%w: gzip content is not a svg document", ErrInvalidSvg)
+		}
+	} else if !isSvg(r) {
+		return svgVector{}, false, nil
+	}
+
+	var src io.Reader = r
+	if limits.MaxFileSize > 0 {
+		// Also limit the decompressed size.
+		src = io.LimitReader(r, limits.MaxFileSize+1)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return svgVector{}, true, err
+	}
+	if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+		return svgVector{}, true, fmt.Errorf("%w: svg content exceeds max file size %d bytes", ErrImageTooLarge, limits.MaxFileSize)
+	}
+
+	data, err = normalizeSvg(data)
+	if err != nil {
+		return svgVector{}, true, err
+	}
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+	if err != nil {
+		return svgVector{}, true, err
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return svgVector{}, true, fmt.Errorf("%w: empty viewBox", ErrInvalidSvg)
+	}
+	return svgVector{icon: icon, data: data}, true, nil
+}
+
+// newSvgReader returns a reader buffering enough content to sniff svg documents.
+func newSvgReader(r io.Reader) *bufio.Reader {
+	return bufio.NewReaderSize(r, svgSniffSize)
+}
+
+// isSvg sniffs the beginning of the content for a root svg element,
+// skipping the xml declaration, doctype, comments and processing instructions before it.
+func isSvg(r *bufio.Reader) bool {
+	head, _ := r.Peek(svgSniffSize)
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(bytes.TrimSpace(head), []byte("<")) {
+		return false
+	}
+	dec := xml.NewDecoder(bytes.NewReader(head))
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return false
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok.Name.Local == "svg"
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return false
+			}
+		}
+	}
+}
+
+// normalizeSvg rewrites the root svg element to always have a viewBox in px,
+// as oksvg only understands the width and height attributes without unit.
+func normalizeSvg(data []byte) ([]byte, error) {
+	return rewriteSvgRoot(data, func(tag string, se xml.StartElement) string {
+		viewBox, width, height := svgAttr(se, "viewBox"), svgAttr(se, "width"), svgAttr(se, "height")
+		tag = svgSizeAttrRegex.ReplaceAllString(tag, "")
+		if strings.TrimSpace(viewBox) != "" {
+			return tag
+		}
+		w, ok := parseSvgLength(width)
+		if !ok {
+			w = svgDefaultWidth
+		}
+		h, ok := parseSvgLength(height)
+		if !ok {
+			h = svgDefaultHeight
+		}
+		return insertSvgAttr(tag, se, "viewBox", fmt.Sprintf("0 0 %s %s", formatSvgNumber(w), formatSvgNumber(h)))
+	})
+}
+
+// rewriteSvgRoot replaces the start tag of the root svg element by the result of the rewrite function.
+func rewriteSvgRoot(data []byte, rewrite func(tag string, se xml.StartElement) string) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// Keep the raw bytes, so the offsets match the data.
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.RawToken()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: missing svg element", ErrInvalidSvg)
+			}
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "svg" {
+			return nil, fmt.Errorf("%w: root element is %s", ErrInvalidSvg, se.Name.Local)
+		}
+		end := dec.InputOffset()
+
+		tag := rewrite(string(data[start:end]), se)
+		out := make([]byte, 0, len(data)+len(tag))
+		out = append(out, data[:start]...)
+		out = append(out, tag...)
+		return append(out, data[end:]...), nil
+	}
+}
+
+func svgAttr(se xml.StartElement, name string) string {
+	for _, attr := range se.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// insertSvgAttr inserts the attribute right after the element name of the start tag.
+func insertSvgAttr(tag string, se xml.StartElement, name string, value string) string {
+	elem := se.Name.Local
+	if se.Name.Space != "" {
+		elem = se.Name.Space + ":" + elem
+	}
+	i := len("<" + elem)
+	return fmt.Sprintf(`%s %s="%s"%s`, tag[:i], name, value, tag[i:])
+}
+
+// parseSvgLength parses the svg length to px.
+// Percentage and unknown units are not supported.
+func parseSvgLength(s string) (float64, bool) {
+	m := svgLengthRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, false
+	}
+	unit, ok := svgLengthUnitToPx[strings.ToLower(m[2])]
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v * unit, true
+}
+
+func formatSvgNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// svgVector renders svg icon using oksvg.
+type svgVector struct {
+	icon *oksvg.SvgIcon
+	// The normalized svg document, used for recoloring.
+	data []byte
+}
+
+func (v svgVector) Bounds() Rect {
+	return Rect{X: v.icon.ViewBox.X, Y: v.icon.ViewBox.Y, W: v.icon.ViewBox.W, H: v.icon.ViewBox.H}
+}
+
+func (v svgVector) Render(dst *image.RGBA, r Rect) {
+	b := dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 || r.W <= 0 || r.H <= 0 {
+		return
+	}
+	sx := float64(w) / r.W
+	sy := float64(h) / r.H
+	t := rasterx.Identity.
+		Translate(float64(b.Min.X)-r.X*sx, float64(b.Min.Y)-r.Y*sy).
+		Scale(sx, sy)
+	d := rasterx.NewDasher(w, h, rasterx.NewScannerGV(w, h, dst, b))
+	// The icon is shared by the renders of the decoded image, so its Transform is not set.
+	// Drawing a path mutates it, so each path is drawn from a copy.
+	for _, path := range v.icon.SVGPaths {
+		path.DrawTransformed(d, 1, t)
+	}
+}
+
+// Recolor overrides the fill and stroke colors of the parsed svg paths, so text and styles of the document are untouched.
+// Paths without fill are painted black by default, so they are also recolored.
+// In tint mode, the color is multiplied with the original color, and gradients are kept as their stops are tinted.
+func (v svgVector) Recolor(c color.Color, tint bool) (Vector, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(v.data))
+	if err != nil {
+		return v, err
+	}
+	paint := func(original color.Color) color.Color {
+		p := c
+		if tint {
+			p = utils.MultiplyColor(original, c)
+		}
+		// The paint is opaque, its opacity is set by the path.
+		nc := color.NRGBAModel.Convert(p).(color.NRGBA)
+		nc.A = 0xff
+		return nc
+	}
+	if tint {
+		// The gradients of the paths share their stops with the gradients of the icon.
+		for _, grad := range icon.Grads {
+			for i, stop := range grad.Stops {
+				if stop.StopColor != nil {
+					grad.Stops[i].StopColor = paint(stop.StopColor)
+				}
+			}
+		}
+	}
+	for i := range icon.SVGPaths {
+		path := &icon.SVGPaths[i]
+		fill, ok := svgPathPaint(path.PathStyle, "fillerColor")
+		if !ok {
+			return v, fmt.Errorf("%w: fill", ErrUnsupportedSvgPaint)
+		}
+		line, ok := svgPathPaint(path.PathStyle, "linerColor")
+		if !ok {
+			return v, fmt.Errorf("%w: stroke", ErrUnsupportedSvgPaint)
+		}
+		switch fill {
+		case svgPaintColor:
+			path.SetFillColor(paint(path.GetFillColor()))
+		case svgPaintGradient:
+			if !tint {
+				path.SetFillColor(paint(nil))
+			}
+		}
+		switch line {
+		case svgPaintColor:
+			path.SetLineColor(paint(path.GetLineColor()))
+		case svgPaintGradient:
+			if !tint {
+				path.SetLineColor(paint(nil))
+			}
+		}
+	}
+	return svgVector{icon: icon, data: v.data}, nil
+}
+
+// Kinds of paint of svg paths.
+const (
+	svgPaintNone = iota
+	svgPaintColor
+	svgPaintGradient
+)
+
+// svgPathPaint returns the kind of the fill or stroke paint of the path style.
+// oksvg does not export the paint, and its getters return black for both no paint and gradients.
+// It returns false if the field is not found, for example if it is renamed by a newer oksvg.
+func svgPathPaint(style oksvg.PathStyle, field string) (int, bool) {
+	paint := reflect.ValueOf(style).FieldByName(field)
+	switch {
+	case !paint.IsValid() || paint.Kind() != reflect.Interface:
+		return 0, false
+	case paint.IsNil():
+		return svgPaintNone, true
+	case paint.Elem().Type() == reflect.TypeFor[rasterx.Gradient]():
+		return svgPaintGradient, true
+	default:
+		return svgPaintColor, true
+	}
+}
@@ -0,0 +1,219 @@
+package scan
+
+import (
+	"bytes"
+	"github.com/srwiley/oksvg"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseSvgLength(t *testing.T) {
+	tests := []struct {
+		s   string
+		exp float64
+		ok  bool
+	}{
+		{s: "24", exp: 24, ok: true},
+		{s: "24px", exp: 24, ok: true},
+		{s: "1in", exp: 96, ok: true},
+		{s: "2.54cm", exp: 96, ok: true},
+		{s: "72pt", exp: 96, ok: true},
+		{s: " 1e1 ", exp: 10, ok: true},
+		{s: "100%"},
+		{s: "0"},
+		{s: ""},
+		{s: "auto"},
+	}
+
+	for _, test := range tests {
+		got, ok := parseSvgLength(test.s)
+		if ok != test.ok || math.Abs(got-test.exp) > 0.000001 {
+			t.Errorf("%q: expected %v %v, got %v %v", test.s, test.exp, test.ok, got, ok)
+		}
+	}
+}
+
+func TestIsSvg(t *testing.T) {
+	license := "<!--" + strings.Repeat(" license text", 200) + " -->\n"
+	tests := []struct {
+		name string
+		data string
+		exp  bool
+	}{
+		{name: "svg", data: `<svg viewBox="0 0 24 24"/>`, exp: true},
+		{name: "bom", data: "\xef\xbb\xbf  <svg/>", exp: true},
+		{name: "long prolog", data: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + license +
+			`<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">` + "\n" +
+			`<svg xmlns="http://www.w3.org/2000/svg"/>`, exp: true},
+		{name: "prefixed", data: `<svg:svg xmlns:svg="http://www.w3.org/2000/svg"/>`, exp: true},
+		{name: "html", data: `<html><svg/></html>`},
+		{name: "text", data: `svg <svg/>`},
+		{name: "png", data: "\x89PNG\r\n\x1a\n"},
+	}
+
+	for _, test := range tests {
+		if got := isSvg(newSvgReader(strings.NewReader(test.data))); got != test.exp {
+			t.Errorf("%s: expected %v, got %v", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestNormalizeSvg(t *testing.T) {
+	tests := []struct {
+		svg string
+		exp string
+	}{
+		{
+			svg: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24" width="100%" height="1em"><path/></svg>`,
+			exp: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path/></svg>`,
+		},
+		{
+			svg: `<?xml version="1.0"?>` + "\n" + `<svg width='1in' height="48"><path/></svg>`,
+			exp: `<?xml version="1.0"?>` + "\n" + `<svg viewBox="0 0 96 48"><path/></svg>`,
+		},
+		{
+			svg: `<svg><path/></svg>`,
+			exp: `<svg viewBox="0 0 300 150"><path/></svg>`,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := normalizeSvg([]byte(test.svg))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.svg, err)
+			continue
+		}
+		if string(got) != test.exp {
+			t.Errorf("%s: expected %s, got %s", test.svg, test.exp, got)
+		}
+	}
+
+	if _, err := normalizeSvg([]byte(`<html><svg/></html>`)); err == nil || !strings.Contains(err.Error(), "root element") {
+		t.Errorf("expected root element error, got %v", err)
+	}
+}
+
+func TestRecolorSvg(t *testing.T) {
+	doc := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 30 10">
+<defs>
+<style>.a{fill:#00ff00}</style>
+<linearGradient id="g"><stop offset="0" stop-color="white"/><stop offset="1" stop-color="white"/></linearGradient>
+</defs>
+<text x="0" y="10">fill: blue; stroke: blue</text>
+<rect class="a" x="0" y="0" width="10" height="10"/>
+<rect fill="none" x="10" y="0" width="10" height="10"/>
+<rect fill="url(#g)" x="20" y="0" width="10" height="10"/>
+</svg>`
+	v, ok, err := readSvg(newSvgReader(strings.NewReader(doc)), Limits{})
+	if err != nil || !ok {
+		t.Fatalf("read svg: %v %v", ok, err)
+	}
+	render := func(v Vector) *image.RGBA {
+		dst := image.NewRGBA(image.Rect(0, 0, 30, 10))
+		v.Render(dst, v.Bounds())
+		return dst
+	}
+
+	red := color.RGBA{R: 255, A: 255}
+	gray := color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 255}
+	transparent := color.RGBA{}
+	tests := []struct {
+		c    color.Color
+		tint bool
+		exp  [3]color.RGBA
+	}{
+		{c: red, exp: [3]color.RGBA{red, transparent, red}},
+		{c: gray, tint: true, exp: [3]color.RGBA{{G: 0x80, A: 255}, transparent, gray}},
+	}
+
+	for _, test := range tests {
+		recolored, err := v.Recolor(test.c, test.tint)
+		if err != nil {
+			t.Fatalf("recolor %v tint=%v: %v", test.c, test.tint, err)
+		}
+		if text := string(recolored.(svgVector).data); !strings.Contains(text, "fill: blue; stroke: blue") {
+			t.Errorf("recolor %v tint=%v: text content changed: %s", test.c, test.tint, text)
+		}
+		img := render(recolored)
+		for i, exp := range test.exp {
+			if got := img.RGBAAt(i*10+5, 5); got != exp {
+				t.Errorf("recolor %v tint=%v: rect %d expected %v, got %v", test.c, test.tint, i, exp, got)
+			}
+		}
+	}
+
+	// The original vector is not modified.
+	if got := render(v).RGBAAt(5, 5); got != (color.RGBA{G: 255, A: 255}) {
+		t.Errorf("original vector changed: got %v", got)
+	}
+}
+
+func TestSvgPathPaint(t *testing.T) {
+	tests := []struct {
+		field string
+		exp   int
+		ok    bool
+	}{
+		// Fails if oksvg renames its paint fields, Recolor then falls back to recoloring the rendered image.
+		{field: "fillerColor", exp: svgPaintColor, ok: true},
+		{field: "linerColor", exp: svgPaintNone, ok: true},
+		{field: "missing"},
+		{field: "LineWidth"},
+	}
+
+	for _, test := range tests {
+		paint, ok := svgPathPaint(oksvg.DefaultStyle, test.field)
+		if paint != test.exp || ok != test.ok {
+			t.Errorf("%s: expected %d %v, got %d %v", test.field, test.exp, test.ok, paint, ok)
+		}
+	}
+}
+
+func TestRenderSvgConcurrent(t *testing.T) {
+	doc := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><circle cx="12" cy="12" r="8" fill="red" stroke="blue"/></svg>`
+	v, ok, err := readSvg(newSvgReader(strings.NewReader(doc)), Limits{})
+	if err != nil || !ok {
+		t.Fatalf("read svg: %v %v", ok, err)
+	}
+	render := func(size int) *image.RGBA {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		v.Render(dst, v.Bounds())
+		return dst
+	}
+	sizes := []int{32, 256}
+	exp := make([]*image.RGBA, len(sizes))
+	transform := v.icon.Transform
+	for i, size := range sizes {
+		exp[i] = render(size)
+	}
+	if got := v.icon.Transform; got != transform {
+		t.Errorf("render changed the shared icon transform to %v", got)
+	}
+
+	// Run with -race, the decoded image is rendered concurrently by the pool.
+	const renders = 8
+	got := make([]*image.RGBA, renders)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range renders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for range 4 {
+				got[i] = render(sizes[i%len(sizes)])
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	for i, img := range got {
+		if !bytes.Equal(img.Pix, exp[i%len(sizes)].Pix) {
+			t.Errorf("render %d: concurrent render differs from the serial render", i)
+		}
+	}
+}
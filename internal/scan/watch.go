@@ -0,0 +1,122 @@
+package scan
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Change is a file added, modified or deleted since the previous changes.
+type Change struct {
+	Path    string
+	Deleted bool
+}
+
+// fileState is the modification time and size of a file, used to detect changes.
+type fileState struct {
+	modTime int64
+	size    int64
+}
+
+// Watch polls the files and the files of the directories every interval, and sends the changes
+// once the files stop changing for the debounce duration, so a burst of saves is sent once.
+// Same as Img, the directories are not scanned recursively. Hidden and backup files are ignored.
+// The channel is closed when the context is done.
+func Watch(ctx context.Context, paths []string, interval time.Duration, debounce time.Duration) <-chan []Change {
+	ch := make(chan []Change)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// The state of the files when the last changes were sent, and when last polled.
+		sent := snapshot(paths)
+		prev := sent
+		var changedAt time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				cur := snapshot(paths)
+				if !maps.Equal(cur, prev) {
+					prev, changedAt = cur, now
+					continue
+				}
+				if now.Sub(changedAt) < debounce {
+					continue
+				}
+				changes := diff(sent, cur)
+				if len(changes) == 0 {
+					continue
+				}
+				sent = cur
+				select {
+				case ch <- changes:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// snapshot returns the state of the files and the files of the directories.
+// Paths that cannot be read are missing from the snapshot, the same as deleted.
+func snapshot(paths []string) map[string]fileState {
+	files := make(map[string]fileState)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files[path] = fileState{modTime: info.ModTime().UnixNano(), size: info.Size()}
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || isIgnored(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			files[filepath.Join(path, entry.Name())] = fileState{modTime: info.ModTime().UnixNano(), size: info.Size()}
+		}
+	}
+	return files
+}
+
+// isIgnored reports whether the file is a hidden or backup file, for example created by editors when saving.
+func isIgnored(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
+}
+
+// diff returns the changes from the old to the new snapshot, sorted by path.
+func diff(old map[string]fileState, cur map[string]fileState) []Change {
+	var changes []Change
+	for path, state := range cur {
+		if prev, ok := old[path]; !ok || prev != state {
+			changes = append(changes, Change{Path: path})
+		}
+	}
+	for path := range old {
+		if _, ok := cur[path]; !ok {
+			changes = append(changes, Change{Path: path, Deleted: true})
+		}
+	}
+	slices.SortFunc(changes, func(a, b Change) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return changes
+}
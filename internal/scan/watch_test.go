@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := map[string]fileState{
+		"a.png": {modTime: 1, size: 10},
+		"b.png": {modTime: 1, size: 10},
+		"c.png": {modTime: 1, size: 10},
+		"d.png": {modTime: 1, size: 10},
+	}
+	cur := map[string]fileState{
+		"a.png": {modTime: 1, size: 10},
+		"b.png": {modTime: 2, size: 10},
+		"c.png": {modTime: 1, size: 12},
+		"e.png": {modTime: 1, size: 10},
+	}
+	exp := []Change{
+		{Path: "b.png"},
+		{Path: "c.png"},
+		{Path: "d.png", Deleted: true},
+		{Path: "e.png"},
+	}
+	if changes := diff(old, cur); !slices.Equal(changes, exp) {
+		t.Errorf("expected %v, got %v", exp, changes)
+	}
+	if changes := diff(cur, cur); len(changes) != 0 {
+		t.Errorf("expected no change, got %v", changes)
+	}
+}
+
+func TestIsIgnored(t *testing.T) {
+	tests := []struct {
+		name string
+		exp  bool
+	}{
+		{name: "logo.png"},
+		{name: ".logo.png.swp", exp: true},
+		{name: "logo.png~", exp: true},
+	}
+
+	for _, test := range tests {
+		if ignored := isIgnored(test.name); ignored != test.exp {
+			t.Errorf("%q: expected %v, got %v", test.name, test.exp, ignored)
+		}
+	}
+}
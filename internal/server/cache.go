@@ -0,0 +1,74 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+)
+
+// response is a generated image.
+type response struct {
+	key         string
+	data        []byte
+	contentType string
+	etag        string
+}
+
+// lru is a least recently used cache of the responses, limited by the total size of their data.
+// A nil cache caches nothing.
+type lru struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+}
+
+// newLRU creates a cache holding at most maxSize bytes of data, or returns nil if maxSize is not positive.
+func newLRU(maxSize int64) *lru {
+	if maxSize <= 0 {
+		return nil
+	}
+	return &lru{
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) get(key string) (*response, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*response), true
+}
+
+// add caches the response, evicting the least recently used responses to fit it.
+// Response bigger than the whole cache is not cached.
+func (c *lru) add(r *response) {
+	if c == nil || int64(len(r.data)) > c.maxSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[r.key]; ok {
+		c.size += int64(len(r.data)) - int64(len(e.Value.(*response).data))
+		e.Value = r
+		c.ll.MoveToFront(e)
+	} else {
+		c.items[r.key] = c.ll.PushFront(r)
+		c.size += int64(len(r.data))
+	}
+	for c.size > c.maxSize {
+		e := c.ll.Back()
+		old := c.ll.Remove(e).(*response)
+		delete(c.items, old.key)
+		c.size -= int64(len(old.data))
+	}
+}
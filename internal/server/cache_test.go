@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	c := newLRU(10)
+	c.add(&response{key: "a", data: make([]byte, 4)})
+	c.add(&response{key: "b", data: make([]byte, 4)})
+	// Use a, so b is the least recently used.
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.add(&response{key: "c", data: make([]byte, 4)})
+	if _, ok := c.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+
+	c.add(&response{key: "big", data: make([]byte, 11)})
+	if _, ok := c.get("big"); ok {
+		t.Error("expected response bigger than the cache to not be cached")
+	}
+	if c.size != 8 {
+		t.Errorf("size = %d, want 8", c.size)
+	}
+
+	var disabled *lru
+	disabled.add(&response{key: "a"})
+	if _, ok := disabled.get("a"); ok {
+		t.Error("expected nil cache to cache nothing")
+	}
+}
@@ -0,0 +1,449 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxTextLength is the maximum number of characters of the placeholder text.
+const maxTextLength = 1000
+
+// Limits of the placeholder parameters which cost grows with their value.
+const (
+	maxStrokeWidth   = 32
+	minPatternSize   = 4
+	minLineHeight    = 0.5
+	maxLineHeight    = 3
+	minLetterSpacing = -0.5
+	maxLetterSpacing = 1
+)
+
+var hexColorRegex = regexp.MustCompile(`^(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// formatExts maps the file extensions of the last path segment to the output format.
+var formatExts = map[string]string{
+	".png":  icon.FormatPNG,
+	".jpg":  icon.FormatJPEG,
+	".jpeg": icon.FormatJPEG,
+	".gif":  icon.FormatGIF,
+	".bmp":  icon.FormatBMP,
+	".svg":  icon.FormatSVG,
+}
+
+var contentTypes = map[string]string{
+	icon.FormatPNG:  "image/png",
+	icon.FormatJPEG: "image/jpeg",
+	icon.FormatGIF:  "image/gif",
+	icon.FormatBMP:  "image/bmp",
+	icon.FormatSVG:  "image/svg+xml",
+}
+
+// Config of the server.
+type Config struct {
+	// Placeholder and Icon are the default flags, overridden by the query parameters.
+	Placeholder icon.PlaceholderFlags
+	Icon        icon.Flags
+	// Limits of the uploaded images, the MaxFileSize also limits the request body.
+	Limits scan.Limits
+	// MaxPixels is the maximum number of pixels of the generated images, 0 for unlimited.
+	MaxPixels int64
+	// Jobs is the number of images generated concurrently, the other requests wait.
+	Jobs int
+	// CacheSize is the maximum bytes of the cached images, 0 to disable the cache.
+	CacheSize int64
+	// MaxAge of the Cache-Control header.
+	MaxAge time.Duration
+}
+
+// Server serves the placeholders and the icons generated from uploaded images.
+//
+//	GET  /{size}[/{bg}[/{fg}]][.format]?text=...
+//	POST /icon?size=...
+type Server struct {
+	cfg   Config
+	cache *lru
+	jobs  chan struct{}
+	mux   *http.ServeMux
+}
+
+func New(cfg Config) *Server {
+	s := &Server{
+		cfg:   cfg,
+		cache: newLRU(cfg.CacheSize),
+		jobs:  make(chan struct{}, max(cfg.Jobs, 1)),
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /icon", s.handleIcon)
+	s.mux.HandleFunc("GET /{size}", s.handlePlaceholder)
+	s.mux.HandleFunc("GET /{size}/{bg}", s.handlePlaceholder)
+	s.mux.HandleFunc("GET /{size}/{bg}/{fg}", s.handlePlaceholder)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handlePlaceholder(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Path + "?" + r.URL.Query().Encode()
+	if res, ok := s.cache.get(key); ok {
+		s.serve(w, r, res)
+		return
+	}
+
+	f, text, err := s.parsePlaceholder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.generate(w, r, key, contentTypes[f.Format], func(w io.Writer) error {
+		// Stop rendering once the request is canceled or timed out.
+		return icon.EncodePlaceholder(r.Context(), w, f, text)
+	})
+}
+
+// parsePlaceholder returns the placeholder flags and text of the request.
+// The format is taken from the extension of the last path segment, or the format parameter.
+func (s *Server) parsePlaceholder(r *http.Request) (icon.PlaceholderFlags, string, error) {
+	f := s.cfg.Placeholder
+	segments := []string{r.PathValue("size"), r.PathValue("bg"), r.PathValue("fg")}
+	last := len(segments) - 1
+	for last > 0 && segments[last] == "" {
+		last--
+	}
+	if format, ok := formatExts[strings.ToLower(path.Ext(segments[last]))]; ok {
+		f.Format = format
+		segments[last] = strings.TrimSuffix(segments[last], path.Ext(segments[last]))
+	}
+
+	sizes, ok := icon.ParsePlaceholderSize(segments[0])
+	if !ok {
+		return f, "", fmt.Errorf("invalid size %q", segments[0])
+	}
+	if segments[1] != "" {
+		f.Background = parseColor(segments[1])
+	}
+	if segments[2] != "" {
+		f.TextColor = parseColor(segments[2])
+	}
+
+	q := params{q: r.URL.Query()}
+	text := q.q.Get("text")
+	q.choice("format", &f.Format, icon.PlaceholderFormats)
+	q.int("quality", &f.Quality)
+	q.uint("padding", &f.Padding)
+	q.uint("round", &f.Round)
+	q.choice("style", &f.Style, icon.PlaceholderStyles)
+	q.int("pattern-size", &f.PatternSize)
+	q.string("seed", &f.Seed)
+	q.float("min-contrast", &f.MinContrast)
+	q.int("max-lines", &f.MaxLines)
+	q.float("min-font-size", &f.MinFontSize)
+	q.float("line-height", &f.LineHeight)
+	q.int("stroke", &f.StrokeWidth)
+	q.color("stroke-color", &f.StrokeColor)
+	q.int("shadow-x", &f.ShadowX)
+	q.int("shadow-y", &f.ShadowY)
+	q.color("shadow-color", &f.ShadowColor)
+	q.float("letter-spacing", &f.LetterSpacing)
+	q.choice("align", &f.AlignX, icon.Aligns)
+	q.choice("valign", &f.AlignY, icon.Aligns)
+	q.bool("uppercase", &f.Uppercase)
+	if q.err != nil {
+		return f, "", q.err
+	}
+	if f.Quality < 1 || f.Quality > 100 {
+		return f, "", fmt.Errorf("invalid quality %d, must be between 1 and 100", f.Quality)
+	}
+	if utf8.RuneCountInString(text) > maxTextLength {
+		return f, "", fmt.Errorf("text exceeds %d characters", maxTextLength)
+	}
+	if f.StrokeWidth < 0 || f.StrokeWidth > maxStrokeWidth {
+		return f, "", fmt.Errorf("invalid stroke %d, must be between 0 and %d", f.StrokeWidth, maxStrokeWidth)
+	}
+	if f.PatternSize != 0 && f.PatternSize < minPatternSize {
+		return f, "", fmt.Errorf("invalid pattern-size %d, must be at least %d", f.PatternSize, minPatternSize)
+	}
+
+	// The @Nx suffix gives the sizes from 1x to Nx, only the highest density is served.
+	f = f.WithDensity(sizes[len(sizes)-1])
+	if s.cfg.MaxPixels > 0 && int64(f.W)*int64(f.H) > s.cfg.MaxPixels {
+		return f, "", fmt.Errorf("size %dx%d exceeds max pixels %d", f.W, f.H, s.cfg.MaxPixels)
+	}
+	if err := checkPlaceholderBounds(f); err != nil {
+		return f, "", err
+	}
+	return f, text, nil
+}
+
+// checkPlaceholderBounds rejects the text parameters out of the bounds of the placeholder size,
+// as they only add work without changing the image.
+func checkPlaceholderBounds(f icon.PlaceholderFlags) error {
+	if f.MaxLines < 0 || f.MaxLines > f.H {
+		return fmt.Errorf("invalid max-lines %d, must be between 0 and the height %d", f.MaxLines, f.H)
+	}
+	if f.MinFontSize < 0 || f.MinFontSize > float64(f.H) {
+		return fmt.Errorf("invalid min-font-size %g, must be between 0 and the height %d", f.MinFontSize, f.H)
+	}
+	// 0 is the default line height.
+	if f.LineHeight != 0 && (f.LineHeight < minLineHeight || f.LineHeight > maxLineHeight) {
+		return fmt.Errorf("invalid line-height %g, must be between %g and %g", f.LineHeight, minLineHeight, float64(maxLineHeight))
+	}
+	if f.LetterSpacing < minLetterSpacing || f.LetterSpacing > maxLetterSpacing {
+		return fmt.Errorf("invalid letter-spacing %g, must be between %g and %g", f.LetterSpacing, minLetterSpacing, float64(maxLetterSpacing))
+	}
+	if f.ShadowX < -f.W || f.ShadowX > f.W {
+		return fmt.Errorf("invalid shadow-x %d, must be between -%d and %d", f.ShadowX, f.W, f.W)
+	}
+	if f.ShadowY < -f.H || f.ShadowY > f.H {
+		return fmt.Errorf("invalid shadow-y %d, must be between -%d and %d", f.ShadowY, f.H, f.H)
+	}
+	return nil
+}
+
+func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
+	f := s.cfg.Icon
+	q := params{q: r.URL.Query()}
+	q.uint("size", &f.Size)
+	q.uint("padding", &f.Padding)
+	q.uint("round", &f.Round)
+	q.uint("src-round", &f.SrcRound)
+	q.int("padx", &f.PadX)
+	q.int("pady", &f.PadY)
+	q.color("bg", &f.Background)
+	q.color("fg", &f.Foreground)
+	q.bool("tint", &f.Tint)
+	q.string("trim", &f.Trim)
+	if q.err != nil {
+		http.Error(w, q.err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.Size == 0 || (s.cfg.MaxPixels > 0 && int64(f.Size)*int64(f.Size) > s.cfg.MaxPixels) {
+		http.Error(w, fmt.Sprintf("invalid size %d", f.Size), http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.readUpload(w, r)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(data)
+	key := r.URL.Path + "?" + r.URL.Query().Encode() + "#" + hex.EncodeToString(sum[:])
+	if res, ok := s.cache.get(key); ok {
+		s.serve(w, r, res)
+		return
+	}
+
+	img, err := scan.DecodeReader(bytes.NewReader(data), "upload", s.cfg.Limits)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, scan.ErrImageTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	s.generate(w, r, key, contentTypes[icon.FormatPNG], func(w io.Writer) error {
+		return icon.EncodeIcon(r.Context(), w, f, img)
+	})
+}
+
+// readUpload reads the uploaded image, either the file field of a multipart form or the whole body.
+func (s *Server) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body := r.Body
+	if s.cfg.Limits.MaxFileSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.cfg.Limits.MaxFileSize)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(body)
+	}
+
+	r.Body = body
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("missing file field")
+			}
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return io.ReadAll(part)
+		}
+	}
+}
+
+// generate encodes the image, limited by the number of concurrent jobs, then caches and serves it.
+func (s *Server) generate(w http.ResponseWriter, r *http.Request, key string, contentType string, encode func(w io.Writer) error) {
+	select {
+	case s.jobs <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	now := time.Now()
+	var buf bytes.Buffer
+	err := encode(&buf)
+	<-s.jobs
+	if err != nil && r.Context().Err() != nil {
+		// The client is gone or the timeout response is already written.
+		slog.Debug("Canceled encoding image", slog.String("path", r.URL.Path), slog.Any("err", err))
+		return
+	}
+	if err != nil {
+		slog.Error("Error encoding image", slog.String("path", r.URL.Path), slog.Any("err", err))
+		http.Error(w, "error encoding image", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Generated",
+		slog.String("path", r.URL.Path),
+		slog.Int("size", buf.Len()),
+		slog.Duration("took", time.Since(now)))
+
+	sum := sha256.Sum256(buf.Bytes())
+	res := &response{
+		key:         key,
+		data:        buf.Bytes(),
+		contentType: contentType,
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+	s.cache.add(res)
+	s.serve(w, r, res)
+}
+
+// serve writes the response, or not modified if the client has the same ETag.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, res *response) {
+	w.Header().Set("Content-Type", res.contentType)
+	w.Header().Set("ETag", res.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.cfg.MaxAge.Seconds())))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(res.data))
+}
+
+// parseColor adds the # prefix to the hex color, as it cannot be used in the path.
+func parseColor(c string) string {
+	if hexColorRegex.MatchString(c) {
+		return "#" + c
+	}
+	return c
+}
+
+// params reads the query parameters, keeping the first error.
+type params struct {
+	q   url.Values
+	err error
+}
+
+func (p *params) value(name string) (string, bool) {
+	if p.err != nil || !p.q.Has(name) {
+		return "", false
+	}
+	return p.q.Get(name), true
+}
+
+func (p *params) string(name string, v *string) {
+	if s, ok := p.value(name); ok {
+		*v = s
+	}
+}
+
+func (p *params) color(name string, v *string) {
+	if s, ok := p.value(name); ok {
+		*v = parseColor(s)
+	}
+}
+
+func (p *params) choice(name string, v *string, choices []string) {
+	s, ok := p.value(name)
+	if !ok {
+		return
+	}
+	if !slices.Contains(choices, s) {
+		p.err = fmt.Errorf("invalid %s %q, must be one of %s", name, s, strings.Join(choices, ", "))
+		return
+	}
+	*v = s
+}
+
+func (p *params) int(name string, v *int) {
+	s, ok := p.value(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, s)
+		return
+	}
+	*v = n
+}
+
+func (p *params) uint(name string, v *uint) {
+	s, ok := p.value(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, s)
+		return
+	}
+	*v = uint(n)
+}
+
+func (p *params) float(name string, v *float64) {
+	s, ok := p.value(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, s)
+		return
+	}
+	*v = n
+}
+
+func (p *params) bool(name string, v *bool) {
+	s, ok := p.value(name)
+	if !ok {
+		return
+	}
+	// A parameter without value, for example ?uppercase, is true.
+	if s == "" {
+		*v = true
+		return
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, s)
+		return
+	}
+	*v = b
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"github.com/mawngo/piconic/internal/icon"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestServer() *Server {
+	return New(Config{
+		Placeholder: icon.PlaceholderFlags{
+			MaxLines:   3,
+			LineHeight: 1,
+			AlignX:     icon.AlignCenter,
+			AlignY:     icon.AlignCenter,
+			Format:     icon.FormatPNG,
+			Quality:    icon.DefaultJPEGQuality,
+		},
+	})
+}
+
+func TestPlaceholderBounds(t *testing.T) {
+	tests := []struct {
+		target string
+		status int
+	}{
+		{target: "/300x250", status: http.StatusOK},
+		{target: "/300x250?min-font-size=250", status: http.StatusOK},
+		{target: "/300x250?min-font-size=251", status: http.StatusBadRequest},
+		{target: "/300x250@2x?min-font-size=251", status: http.StatusBadRequest},
+		{target: "/300x250?min-font-size=-1", status: http.StatusBadRequest},
+		{target: "/300x250?max-lines=250", status: http.StatusOK},
+		{target: "/300x250?max-lines=251", status: http.StatusBadRequest},
+		{target: "/300x250?line-height=1.5", status: http.StatusOK},
+		{target: "/300x250?line-height=0.2", status: http.StatusBadRequest},
+		{target: "/300x250?line-height=10", status: http.StatusBadRequest},
+		{target: "/300x250?letter-spacing=-0.5", status: http.StatusOK},
+		{target: "/300x250?letter-spacing=-1", status: http.StatusBadRequest},
+		{target: "/300x250?letter-spacing=5", status: http.StatusBadRequest},
+		{target: "/300x250?shadow-x=-300&shadow-y=250", status: http.StatusOK},
+		{target: "/300x250?shadow-x=301", status: http.StatusBadRequest},
+		{target: "/300x250?shadow-y=-251", status: http.StatusBadRequest},
+	}
+
+	s := newTestServer()
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d %s", test.target, test.status, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestPlaceholderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/300x250?text=canceled", nil).WithContext(ctx))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no response for the canceled request, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -2,6 +2,7 @@
 
 import (
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"math"
@@ -13,7 +14,7 @@
 func ParseHexColor(s string) (c color.RGBA, err error) {
 	c.A = 0xff
 
-	if s[0] != '#' {
+	if len(s) == 0 || s[0] != '#' {
 		return c, ErrInvalidHexColor
 	}
 
@@ -39,6 +40,15 @@ func ParseHexColor(s string) (c color.RGBA, err error) {
 		c.R = hexToByte(s[1]) * 17
 		c.G = hexToByte(s[2]) * 17
 		c.B = hexToByte(s[3]) * 17
+	case 9:
+		// With alpha, which must be premultiplied.
+		nc := color.NRGBA{
+			R: hexToByte(s[1])<<4 + hexToByte(s[2]),
+			G: hexToByte(s[3])<<4 + hexToByte(s[4]),
+			B: hexToByte(s[5])<<4 + hexToByte(s[6]),
+			A: hexToByte(s[7])<<4 + hexToByte(s[8]),
+		}
+		c = color.RGBAModel.Convert(nc).(color.RGBA)
 	default:
 		err = ErrInvalidHexColor
 	}
@@ -92,3 +102,107 @@ func yCbCrToRGBA(m image.Image) image.Image {
 	}
 	return nm
 }
+
+// FormatHexColor formats the color as #rrggbb, ignoring its alpha.
+func FormatHexColor(c color.Color) string {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", nc.R, nc.G, nc.B)
+}
+
+// MultiplyColor multiplies the color channels of the two colors.
+func MultiplyColor(c1 color.Color, c2 color.Color) color.Color {
+	n1 := color.NRGBAModel.Convert(c1).(color.NRGBA)
+	n2 := color.NRGBAModel.Convert(c2).(color.NRGBA)
+	return color.NRGBA{
+		R: uint8(uint32(n1.R) * uint32(n2.R) / 0xff),
+		G: uint8(uint32(n1.G) * uint32(n2.G) / 0xff),
+		B: uint8(uint32(n1.B) * uint32(n2.B) / 0xff),
+		A: n1.A,
+	}
+}
+
+// Recolor paints every pixel with the color c while keeping its alpha.
+// If tint is true, the color is multiplied with the pixel color instead.
+func Recolor(m *image.RGBA, c color.Color, tint bool) {
+	cr, cg, cb, _ := c.RGBA()
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := m.PixOffset(x, y)
+			p := m.Pix[i : i+4 : i+4]
+			if tint {
+				// The pixel is alpha-premultiplied, so multiplying keeps it valid.
+				p[0] = uint8(uint32(p[0]) * (cr >> 8) / 0xff)
+				p[1] = uint8(uint32(p[1]) * (cg >> 8) / 0xff)
+				p[2] = uint8(uint32(p[2]) * (cb >> 8) / 0xff)
+				continue
+			}
+			a := uint32(p[3])
+			p[0] = uint8((cr >> 8) * a / 0xff)
+			p[1] = uint8((cg >> 8) * a / 0xff)
+			p[2] = uint8((cb >> 8) * a / 0xff)
+		}
+	}
+}
+
+// HSLColor converts the hue (in degree), saturation and lightness (0..1) to color.
+func HSLColor(h float64, s float64, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	hp := math.Mod(h, 360) / 60
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+	var r, g, b float64
+	switch {
+	case hp < 1:
+		r, g, b = c, x, 0
+	case hp < 2:
+		r, g, b = x, c, 0
+	case hp < 3:
+		r, g, b = 0, c, x
+	case hp < 4:
+		r, g, b = 0, x, c
+	case hp < 5:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := l - c/2
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 0xff,
+	}
+}
+
+// DilateAlpha grows the shape of the mask by r pixels, returning a new mask.
+func DilateAlpha(m *image.Alpha, r int) *image.Alpha {
+	b := m.Bounds()
+	out := image.NewAlpha(b)
+	// Offsets inside the disk of radius r.
+	var offsets []image.Point
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if dx*dx+dy*dy <= r*r {
+				offsets = append(offsets, image.Point{X: dx, Y: dy})
+			}
+		}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a := m.Pix[m.PixOffset(x, y)]
+			if a == 0 {
+				continue
+			}
+			for _, o := range offsets {
+				p := image.Point{X: x + o.X, Y: y + o.Y}
+				if !p.In(b) {
+					continue
+				}
+				if i := out.PixOffset(p.X, p.Y); out.Pix[i] < a {
+					out.Pix[i] = a
+				}
+			}
+		}
+	}
+	return out
+}
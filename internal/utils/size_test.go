@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		s   string
+		exp int64
+		err error
+	}{
+		{s: "0", exp: 0},
+		{s: "1024", exp: 1024},
+		{s: "512MB", exp: 512 * 1000 * 1000},
+		{s: "2GiB", exp: 2 << 30},
+		{s: "1.5 kb", exp: 1500},
+		{s: "10x", err: ErrInvalidByteSize},
+		{s: "MB", err: ErrInvalidByteSize},
+		{s: "", err: ErrInvalidByteSize},
+	}
+
+	for _, test := range tests {
+		got, err := ParseByteSize(test.s)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: expected err %v, got %v", test.s, test.err, err)
+			continue
+		}
+		if got != test.exp {
+			t.Errorf("%q: expected %d, got %d", test.s, test.exp, got)
+		}
+	}
+}
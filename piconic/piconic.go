@@ -0,0 +1,432 @@
+// Package piconic renders icons from images and placeholder images.
+//
+// The rendering is pure: it does not read or write files and only logs to the logger of WithLogger,
+// unsupported options are returned as errors instead of falling back to defaults.
+package piconic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mawngo/piconic/internal/icon"
+	"github.com/mawngo/piconic/internal/scan"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Formats supported by Encode. FormatSVG is only supported by EncodePlaceholderSVG.
+const (
+	FormatPNG  = icon.FormatPNG
+	FormatJPEG = icon.FormatJPEG
+	FormatGIF  = icon.FormatGIF
+	FormatBMP  = icon.FormatBMP
+	FormatSVG  = icon.FormatSVG
+)
+
+// Styles of the placeholder background.
+const (
+	StyleFlat         = icon.PlaceholderStyleFlat
+	StyleWireframe    = icon.PlaceholderStyleWireframe
+	StyleCheckerboard = icon.PlaceholderStyleCheckerboard
+	StyleStripes      = icon.PlaceholderStyleStripes
+	StyleGrid         = icon.PlaceholderStyleGrid
+	StyleArrows       = icon.PlaceholderStyleArrows
+)
+
+// Alignments of the placeholder text.
+const (
+	AlignStart  = icon.AlignStart
+	AlignCenter = icon.AlignCenter
+	AlignEnd    = icon.AlignEnd
+)
+
+// Weights of the embedded Roboto font.
+const (
+	FontWeightRegular  = icon.FontWeightRegular
+	FontWeightMedium   = icon.FontWeightMedium
+	FontWeightSemiBold = icon.FontWeightSemiBold
+	FontWeightBold     = icon.FontWeightBold
+)
+
+// NoText is the placeholder text for drawing no text.
+const NoText = "<none>"
+
+var (
+	ErrInvalidOption = errors.New("invalid option")
+	ErrInvalidColor  = icon.ErrInvalidColor
+	ErrInvalidFont   = icon.ErrInvalidFont
+	// ErrUnknownFontWeight is returned by EmbeddedFont for the weights other than the FontWeight constants.
+	ErrUnknownFontWeight = icon.ErrUnknownFontWeight
+)
+
+// discardLogger drops the logs of the internal renderer, as the options are validated beforehand.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+type loggerKey struct{}
+
+// WithLogger returns the context logging the fallbacks of the rendering to the logger,
+// for example the vector recolored as an image or the characters missing from the fonts.
+// Without it, the rendering does not log.
+func WithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if log, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && log != nil {
+		return log
+	}
+	return discardLogger
+}
+
+// Font is a list of fonts used to draw the placeholder text, the later fonts are fallbacks of the earlier ones.
+type Font = icon.Font
+
+// NewFont parses the TTF/OTF fonts, the first font is the primary font.
+func NewFont(data ...[]byte) (*Font, error) {
+	return icon.NewFont(data...)
+}
+
+// EmbeddedFont returns the embedded Roboto font of the weight.
+// It has no CJK glyphs, use NewFont with a CJK fallback font to draw CJK text.
+func EmbeddedFont(weight string) (*Font, error) {
+	return icon.LoadFont("", weight, nil)
+}
+
+// IconOptions of RenderIcon. Percentages are relative to the Size.
+type IconOptions struct {
+	// Size of the square output image, in pixel.
+	Size int
+	// Padding around the image, in %.
+	Padding int
+	// Round the corners of the output image, in %.
+	Round int
+	// SrcRound rounds the corners of the resized source image, in % of its size.
+	SrcRound int
+	// PadX and PadY move the image, in %.
+	PadX int
+	PadY int
+	// Background color: hex, material or svg 1.1 color name, transparent,
+	// auto (the border color of the image) or auto with a fallback, for example auto,#f1f5f9.
+	Background string
+	// Foreground recolors the source image, empty to keep the original colors, auto for the contrast of the background.
+	Foreground string
+	// Tint multiplies the source colors with the Foreground instead of replacing them.
+	Tint bool
+	// Trim are the colors trimmed from the edges of the image, same format as the Background.
+	Trim []string
+}
+
+// DefaultIconOptions returns the options used by the CLI.
+func DefaultIconOptions() IconOptions {
+	return IconOptions{
+		Size:       200,
+		Padding:    10,
+		Background: icon.AutoColor + "," + icon.BackgroundDefaultColor,
+		Trim:       []string{icon.TransparentColor},
+	}
+}
+
+// Icon is the rendered icon, and the values resolved from the source image.
+type Icon struct {
+	image.Image
+	// Background is the resolved background color.
+	Background color.Color
+	// Trim is the area of the source image kept after trimming.
+	Trim image.Rectangle
+}
+
+// PlaceholderOptions of RenderPlaceholder.
+type PlaceholderOptions struct {
+	// Width and Height of the placeholder at 1x density, in pixel.
+	Width  int
+	Height int
+	// Density multiplies the size of the output image and the other sizes in pixel, 0 for 1x.
+	// The default text is the size at 1x.
+	Density int
+	// Text of the placeholder, empty for the size, NoText for no text.
+	// It may end with a <color> suffix, for example "hello <white>", overriding the TextColor.
+	Text string
+	// TextColor is a hex, material or svg 1.1 color name, empty or auto for the contrast of the background.
+	TextColor string
+	// Background color, auto for a color picked from the Seed, the Text and the size.
+	Background string
+	// Padding around the text, in % of the size.
+	Padding int
+	// Round the corners of the output image, in % of the size.
+	Round int
+	// Seed of the auto colors.
+	Seed string
+	// MinContrast is the minimum contrast ratio between the auto color and the other color, 0 to disable.
+	MinContrast float64
+	// MaxLines is the maximum number of lines the text is wrapped into, 0 for single line.
+	MaxLines int
+	// MinFontSize is the font size which the text is truncated with an ellipsis instead of shrinking further.
+	MinFontSize float64
+	// LineHeight is the distance between lines, relative to the font height, 0 for 1.
+	LineHeight float64
+	// Font of the text, nil for the embedded Roboto SemiBold.
+	Font *Font
+	// StrokeWidth is the width of the text outline in pixel, 0 to disable.
+	StrokeWidth int
+	// StrokeColor of the text outline, auto for the contrast of the text color.
+	StrokeColor string
+	// ShadowX and ShadowY are the offset of the text shadow in pixel, both 0 to disable.
+	ShadowX     int
+	ShadowY     int
+	ShadowColor string
+	// LetterSpacing is the extra space between characters, relative to the font size.
+	LetterSpacing float64
+	// AlignX and AlignY are the alignment of the text, empty for center.
+	AlignX string
+	AlignY string
+	// Uppercase transforms the text to uppercase.
+	Uppercase bool
+	// Style of the background pattern, empty for flat.
+	Style string
+	// PatternSize is the cell size of the pattern in pixel, 0 for default.
+	PatternSize int
+}
+
+// DefaultPlaceholderOptions returns the options used by the CLI, for the size.
+func DefaultPlaceholderOptions(w int, h int) PlaceholderOptions {
+	f := icon.DefaultPlaceholderFlags()
+	return PlaceholderOptions{
+		Width:       w,
+		Height:      h,
+		Background:  f.Background,
+		Padding:     int(f.Padding),
+		MaxLines:    f.MaxLines,
+		LineHeight:  f.LineHeight,
+		StrokeColor: f.StrokeColor,
+		ShadowColor: f.ShadowColor,
+		AlignX:      f.AlignX,
+		AlignY:      f.AlignY,
+		Style:       f.Style,
+	}
+}
+
+// Validate returns the error of the invalid option, the same as RenderIcon.
+func (opts IconOptions) Validate() error {
+	_, err := opts.flags(discardLogger)
+	return err
+}
+
+// Validate returns the error of the invalid option, the same as RenderPlaceholder.
+func (opts PlaceholderOptions) Validate() error {
+	_, err := opts.flags(discardLogger)
+	return err
+}
+
+// RenderIcon renders the icon of the image.
+func RenderIcon(ctx context.Context, img image.Image, opts IconOptions) (*Icon, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The images decoded by the command line are passed as is, so their vector is rendered at the output size.
+	decoded, ok := img.(scan.DecodedImage)
+	if !ok {
+		if img == nil || img.Bounds().Empty() {
+			return nil, fmt.Errorf("%w: empty image", ErrInvalidOption)
+		}
+		decoded = decodedImage(img)
+	}
+	f, err := opts.flags(loggerFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out, bg, trim, err := icon.RenderIconDetails(ctx, f, decoded)
+	if err != nil {
+		return nil, err
+	}
+	return &Icon{Image: out, Background: bg, Trim: trim}, nil
+}
+
+// RenderPlaceholder renders the placeholder image.
+func RenderPlaceholder(ctx context.Context, opts PlaceholderOptions) (image.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := opts.flags(loggerFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	out, err := icon.RenderPlaceholder(ctx, f, opts.Text)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PlaceholderColors returns the background and the text colors of the placeholder, with the auto colors resolved.
+func PlaceholderColors(opts PlaceholderOptions) (color.Color, color.Color, error) {
+	f, err := opts.flags(discardLogger)
+	if err != nil {
+		return nil, nil, err
+	}
+	bg, text := icon.PlaceholderColors(f, opts.Text)
+	return bg, text, nil
+}
+
+// EncodePlaceholderSVG writes the placeholder as svg, the text is drawn using the fonts of the viewer.
+func EncodePlaceholderSVG(ctx context.Context, w io.Writer, opts PlaceholderOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := opts.flags(loggerFrom(ctx))
+	if err != nil {
+		return err
+	}
+	f.Format = FormatSVG
+	return icon.EncodePlaceholder(ctx, w, f, opts.Text)
+}
+
+// Encode writes the image in the raster format, empty for png.
+// The quality is only used by jpeg, 0 for default.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	if format == FormatSVG {
+		return fmt.Errorf("%w: svg is only supported by EncodePlaceholderSVG", ErrInvalidOption)
+	}
+	if quality < 0 || quality > 100 {
+		return fmt.Errorf("%w: quality %d, must be between 0 and 100", ErrInvalidOption, quality)
+	}
+	return icon.EncodeImage(w, img, format, quality)
+}
+
+// decodedImage wraps the image for the renderer, which requires the bounds to start at the origin.
+func decodedImage(img image.Image) scan.DecodedImage {
+	b := img.Bounds()
+	if b.Min != (image.Point{}) {
+		rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+		img = rgba
+	}
+	return scan.DecodedImage{Image: img, Width: b.Dx(), Height: b.Dy()}
+}
+
+func (opts IconOptions) flags(log *slog.Logger) (icon.Flags, error) {
+	if opts.Size <= 0 {
+		return icon.Flags{}, fmt.Errorf("%w: size %d, must be positive", ErrInvalidOption, opts.Size)
+	}
+	if err := errors.Join(checkPadding(opts.Padding), checkPercent("round", opts.Round), checkPercent("src round", opts.SrcRound)); err != nil {
+		return icon.Flags{}, err
+	}
+	if err := icon.CheckColor(opts.Background, true); err != nil {
+		return icon.Flags{}, err
+	}
+	if opts.Foreground != "" {
+		if err := icon.CheckColor(opts.Foreground, true); err != nil {
+			return icon.Flags{}, err
+		}
+	}
+	for _, c := range opts.Trim {
+		if err := icon.CheckColor(c, true); err != nil {
+			return icon.Flags{}, err
+		}
+	}
+	return icon.Flags{
+		OutputFlags: icon.OutputFlags{
+			Padding:    uint(opts.Padding),
+			Round:      uint(opts.Round),
+			Background: opts.Background,
+			Trim:       strings.Join(opts.Trim, ","),
+			PadX:       opts.PadX,
+			PadY:       opts.PadY,
+			Logger:     log,
+		},
+		Size:       uint(opts.Size),
+		SrcRound:   uint(opts.SrcRound),
+		Foreground: opts.Foreground,
+		Tint:       opts.Tint,
+	}, nil
+}
+
+func (opts PlaceholderOptions) flags(log *slog.Logger) (icon.PlaceholderFlags, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return icon.PlaceholderFlags{}, fmt.Errorf("%w: size %dx%d, must be positive", ErrInvalidOption, opts.Width, opts.Height)
+	}
+	if opts.Density < 0 || opts.Density > icon.MaxPlaceholderDensity {
+		return icon.PlaceholderFlags{}, fmt.Errorf("%w: density %d, must be between 0 and %d", ErrInvalidOption, opts.Density, icon.MaxPlaceholderDensity)
+	}
+	if err := errors.Join(checkPadding(opts.Padding), checkPercent("round", opts.Round)); err != nil {
+		return icon.PlaceholderFlags{}, err
+	}
+	if opts.Style != "" && !slices.Contains(icon.PlaceholderStyles, opts.Style) {
+		return icon.PlaceholderFlags{}, fmt.Errorf("%w: style %q, must be one of %s", ErrInvalidOption, opts.Style, strings.Join(icon.PlaceholderStyles, ", "))
+	}
+	for _, align := range []string{opts.AlignX, opts.AlignY} {
+		if align != "" && !slices.Contains(icon.Aligns, align) {
+			return icon.PlaceholderFlags{}, fmt.Errorf("%w: align %q, must be one of %s", ErrInvalidOption, align, strings.Join(icon.Aligns, ", "))
+		}
+	}
+	if opts.StrokeWidth < 0 {
+		return icon.PlaceholderFlags{}, fmt.Errorf("%w: stroke width %d, must not be negative", ErrInvalidOption, opts.StrokeWidth)
+	}
+	if err := icon.CheckColor(opts.Background, true); err != nil {
+		return icon.PlaceholderFlags{}, err
+	}
+	colors := []string{opts.TextColor, opts.StrokeColor, icon.PlaceholderTextColor(opts.Text)}
+	for _, c := range colors {
+		if c == "" {
+			continue
+		}
+		if err := icon.CheckColor(c, true); err != nil {
+			return icon.PlaceholderFlags{}, err
+		}
+	}
+	if opts.ShadowColor != "" {
+		if err := icon.CheckColor(opts.ShadowColor, false); err != nil {
+			return icon.PlaceholderFlags{}, err
+		}
+	}
+	f := icon.PlaceholderFlags{
+		OutputFlags: icon.OutputFlags{
+			Padding:    uint(opts.Padding),
+			Round:      uint(opts.Round),
+			Background: opts.Background,
+			Logger:     log,
+		},
+		TextColor:     opts.TextColor,
+		Seed:          opts.Seed,
+		MinContrast:   opts.MinContrast,
+		MaxLines:      opts.MaxLines,
+		MinFontSize:   opts.MinFontSize,
+		LineHeight:    opts.LineHeight,
+		Font:          opts.Font,
+		StrokeWidth:   opts.StrokeWidth,
+		StrokeColor:   opts.StrokeColor,
+		ShadowX:       opts.ShadowX,
+		ShadowY:       opts.ShadowY,
+		ShadowColor:   opts.ShadowColor,
+		LetterSpacing: opts.LetterSpacing,
+		AlignX:        opts.AlignX,
+		AlignY:        opts.AlignY,
+		Uppercase:     opts.Uppercase,
+		Style:         opts.Style,
+		PatternSize:   opts.PatternSize,
+	}
+	return f.WithDensity(icon.PlaceholderSize{W: opts.Width, H: opts.Height, Density: opts.Density}), nil
+}
+
+// checkPadding returns an error if the padding leaves no area to draw, as it is applied to both sides.
+func checkPadding(p int) error {
+	if p < 0 || p >= 50 {
+		return fmt.Errorf("%w: padding %d%%, must be between 0 and 49", ErrInvalidOption, p)
+	}
+	return nil
+}
+
+// checkPercent returns an error if the percentage is not between 0 and 100.
+func checkPercent(name string, p int) error {
+	if p < 0 || p > 100 {
+		return fmt.Errorf("%w: %s %d%%, must be between 0 and 100", ErrInvalidOption, name, p)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package piconic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderPlaceholder(t *testing.T) {
+	img, err := RenderPlaceholder(context.Background(), DefaultPlaceholderOptions(300, 250))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 300, 250) {
+		t.Errorf("bounds = %v, want 300x250", img.Bounds())
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, FormatPNG, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Errorf("decode encoded placeholder: %v", err)
+	}
+
+	opts := DefaultPlaceholderOptions(300, 250)
+	opts.Density = 2
+	if img, err = RenderPlaceholder(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 600, 500) {
+		t.Errorf("bounds = %v, want 600x500 at 2x", img.Bounds())
+	}
+}
+
+func TestRenderPlaceholderInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *PlaceholderOptions)
+		want   error
+	}{
+		{name: "size", modify: func(o *PlaceholderOptions) { o.Width = 0 }, want: ErrInvalidOption},
+		{name: "style", modify: func(o *PlaceholderOptions) { o.Style = "dots" }, want: ErrInvalidOption},
+		{name: "padding", modify: func(o *PlaceholderOptions) { o.Padding = 50 }, want: ErrInvalidOption},
+		{name: "density", modify: func(o *PlaceholderOptions) { o.Density = -1 }, want: ErrInvalidOption},
+		{name: "background", modify: func(o *PlaceholderOptions) { o.Background = "nope" }, want: ErrInvalidColor},
+		{name: "text color suffix", modify: func(o *PlaceholderOptions) { o.Text = "hello <nope>" }, want: ErrInvalidColor},
+		{name: "shadow auto", modify: func(o *PlaceholderOptions) { o.ShadowColor = "auto" }, want: ErrInvalidColor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultPlaceholderOptions(300, 250)
+			tt.modify(&opts)
+			img, err := RenderPlaceholder(context.Background(), opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if img != nil {
+				t.Errorf("img = %v, want nil", img)
+			}
+			if err := opts.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("validate err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderIcon(t *testing.T) {
+	// A red square on white, not starting at the origin.
+	src := image.NewRGBA(image.Rect(10, 10, 60, 60))
+	for y := 10; y < 60; y++ {
+		for x := 10; x < 60; x++ {
+			c := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+			if x >= 20 && x < 50 && y >= 20 && y < 50 {
+				c = color.RGBA{R: 0xff, A: 0xff}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	opts := DefaultIconOptions()
+	opts.Size = 64
+	opts.Trim = []string{"#ffffff"}
+	img, err := RenderIcon(context.Background(), src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Errorf("bounds = %v, want 64x64", img.Bounds())
+	}
+	// The white border is trimmed, so the center is red.
+	if r, g, _, _ := img.At(32, 32).RGBA(); r>>8 != 0xff || g != 0 {
+		t.Errorf("center = %v, want red", img.At(32, 32))
+	}
+	// The trimmed area starts at the red square, relative to the bounds of the source.
+	if img.Trim.Min != image.Pt(10, 10) {
+		t.Errorf("trim = %v, want the red square", img.Trim)
+	}
+	if img.Background == nil {
+		t.Errorf("background = nil, want the resolved color")
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := RenderPlaceholder(ctx, DefaultPlaceholderOptions(300, 250)); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestEncodePlaceholderSVG(t *testing.T) {
+	var buf bytes.Buffer
+	opts := DefaultPlaceholderOptions(300, 250)
+	opts.Text = "a < b"
+	if err := EncodePlaceholderSVG(context.Background(), &buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "a &lt; b") {
+		t.Errorf("expected escaped text in svg, got %s", buf.String())
+	}
+}